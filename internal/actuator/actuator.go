@@ -0,0 +1,126 @@
+package actuator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type State string
+
+const (
+	StateLocked   State = "locked"
+	StateUnlocked State = "unlocked"
+	StateUnknown  State = "unknown"
+)
+
+var ErrNotConfirmed = errors.New("actuator did not confirm unlock")
+
+// MaxUnlockTime is how long callers give Unlock before cancelling it.
+// Drivers that retry must fit all their attempts into it.
+const MaxUnlockTime = 10 * time.Second
+
+// DoorActuator drives the physical lock of a door. Unlock must only return
+// nil once the hardware (or remote controller) has confirmed the action.
+type DoorActuator interface {
+	Unlock(ctx context.Context, doorID string, duration time.Duration) error
+	Status(ctx context.Context, doorID string) (State, error)
+}
+
+type Config struct {
+	Driver        string              `json:"driver"`
+	UnlockSeconds int                 `json:"unlock_seconds,omitempty"`
+	GPIO          GPIOConfig          `json:"gpio,omitempty"`
+	HTTP          HTTPRelayConfig     `json:"http,omitempty"`
+	MQTT          MQTTConfig          `json:"mqtt,omitempty"`
+	Webhook       WebhookConfig       `json:"webhook,omitempty"`
+	HomeAssistant HomeAssistantConfig `json:"homeassistant,omitempty"`
+}
+
+func (c Config) UnlockDuration() time.Duration {
+	if c.UnlockSeconds <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.UnlockSeconds) * time.Second
+}
+
+func New(cfg Config) (DoorActuator, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case "", "simulated":
+		return NewSimulated(), nil
+	case "gpio":
+		return NewGPIO(cfg.GPIO)
+	case "http":
+		return NewHTTPRelay(cfg.HTTP)
+	case "mqtt":
+		return NewMQTT(cfg.MQTT)
+	case "webhook":
+		return NewWebhook(cfg.Webhook)
+	case "homeassistant":
+		return NewHomeAssistant(cfg.HomeAssistant)
+	default:
+		return nil, fmt.Errorf("unknown actuator driver %q", cfg.Driver)
+	}
+}
+
+func ConfigFromEnv() Config {
+	return Config{
+		Driver:        os.Getenv("DOOR_ACTUATOR"),
+		UnlockSeconds: getEnvInt("DOOR_UNLOCK_SECONDS", 5),
+		GPIO: GPIOConfig{
+			Pin:       getEnvInt("DOOR_GPIO_PIN", 0),
+			ActiveLow: os.Getenv("DOOR_GPIO_ACTIVE_LOW") == "true",
+			SysfsRoot: os.Getenv("DOOR_GPIO_SYSFS_ROOT"),
+		},
+		HTTP: HTTPRelayConfig{
+			UnlockURL:      os.Getenv("DOOR_RELAY_UNLOCK_URL"),
+			StatusURL:      os.Getenv("DOOR_RELAY_STATUS_URL"),
+			Method:         os.Getenv("DOOR_RELAY_METHOD"),
+			Token:          os.Getenv("DOOR_RELAY_TOKEN"),
+			TimeoutSeconds: getEnvInt("DOOR_RELAY_TIMEOUT_SECONDS", 5),
+		},
+		MQTT: MQTTConfig{
+			Broker:         os.Getenv("DOOR_MQTT_BROKER"),
+			ClientID:       os.Getenv("DOOR_MQTT_CLIENT_ID"),
+			Username:       os.Getenv("DOOR_MQTT_USERNAME"),
+			Password:       os.Getenv("DOOR_MQTT_PASSWORD"),
+			CommandTopic:   os.Getenv("DOOR_MQTT_COMMAND_TOPIC"),
+			StateTopic:     os.Getenv("DOOR_MQTT_STATE_TOPIC"),
+			UnlockPayload:  os.Getenv("DOOR_MQTT_UNLOCK_PAYLOAD"),
+			AckPayload:     os.Getenv("DOOR_MQTT_ACK_PAYLOAD"),
+			QoS:            getEnvInt("DOOR_MQTT_QOS", 1),
+			TimeoutSeconds: getEnvInt("DOOR_MQTT_TIMEOUT_SECONDS", 3),
+			Retries:        getEnvInt("DOOR_MQTT_RETRIES", 2),
+		},
+		Webhook: WebhookConfig{
+			URL:            os.Getenv("DOOR_WEBHOOK_URL"),
+			Method:         os.Getenv("DOOR_WEBHOOK_METHOD"),
+			Headers:        parseHeaders(os.Getenv("DOOR_WEBHOOK_HEADERS")),
+			BearerToken:    os.Getenv("DOOR_WEBHOOK_BEARER_TOKEN"),
+			BodyTemplate:   os.Getenv("DOOR_WEBHOOK_BODY"),
+			ContentType:    os.Getenv("DOOR_WEBHOOK_CONTENT_TYPE"),
+			TimeoutSeconds: getEnvInt("DOOR_WEBHOOK_TIMEOUT_SECONDS", 5),
+		},
+		HomeAssistant: HomeAssistantConfig{
+			BaseURL:        os.Getenv("HA_BASE_URL"),
+			Token:          os.Getenv("HA_TOKEN"),
+			EntityID:       os.Getenv("HA_LOCK_ENTITY"),
+			Code:           os.Getenv("HA_LOCK_CODE"),
+			Relock:         os.Getenv("HA_RELOCK") == "true",
+			ConfirmSeconds: getEnvInt("HA_CONFIRM_SECONDS", 5),
+		},
+	}
+}
+
+func getEnvInt(key string, defaultVal int) int {
+	if val := os.Getenv(key); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			return parsed
+		}
+	}
+	return defaultVal
+}
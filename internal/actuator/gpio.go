@@ -0,0 +1,143 @@
+package actuator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type GPIOConfig struct {
+	Pin       int    `json:"pin"`
+	ActiveLow bool   `json:"active_low,omitempty"`
+	SysfsRoot string `json:"sysfs_root,omitempty"`
+}
+
+// GPIO drives a relay wired to a Linux GPIO line through the sysfs
+// interface. The written value is read back to confirm the relay state.
+type GPIO struct {
+	cfg   GPIOConfig
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+func NewGPIO(cfg GPIOConfig) (*GPIO, error) {
+	if cfg.Pin <= 0 {
+		return nil, errors.New("gpio actuator requires a pin number")
+	}
+	if cfg.SysfsRoot == "" {
+		cfg.SysfsRoot = "/sys/class/gpio"
+	}
+
+	g := &GPIO{cfg: cfg}
+	if err := g.export(); err != nil {
+		return nil, err
+	}
+	if err := g.write(false); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *GPIO) pinDir() string {
+	return filepath.Join(g.cfg.SysfsRoot, "gpio"+strconv.Itoa(g.cfg.Pin))
+}
+
+func (g *GPIO) export() error {
+	if _, err := os.Stat(g.pinDir()); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		exportPath := filepath.Join(g.cfg.SysfsRoot, "export")
+		if err := os.WriteFile(exportPath, []byte(strconv.Itoa(g.cfg.Pin)), 0o200); err != nil {
+			return fmt.Errorf("export gpio %d: %w", g.cfg.Pin, err)
+		}
+		// udev needs a moment to fix permissions on the freshly exported pin
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	direction := filepath.Join(g.pinDir(), "direction")
+	if err := os.WriteFile(direction, []byte("out"), 0o644); err != nil {
+		return fmt.Errorf("set gpio %d direction: %w", g.cfg.Pin, err)
+	}
+	return nil
+}
+
+func (g *GPIO) write(active bool) error {
+	level := active != g.cfg.ActiveLow
+	value := "0"
+	if level {
+		value = "1"
+	}
+	return os.WriteFile(filepath.Join(g.pinDir(), "value"), []byte(value), 0o644)
+}
+
+func (g *GPIO) read() (bool, error) {
+	raw, err := os.ReadFile(filepath.Join(g.pinDir(), "value"))
+	if err != nil {
+		return false, err
+	}
+	level := strings.TrimSpace(string(raw)) == "1"
+	return level != g.cfg.ActiveLow, nil
+}
+
+func (g *GPIO) Unlock(ctx context.Context, doorID string, duration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+
+	if err := g.write(true); err != nil {
+		return fmt.Errorf("energise relay on gpio %d: %w", g.cfg.Pin, err)
+	}
+
+	active, err := g.read()
+	if err != nil {
+		return fmt.Errorf("read back gpio %d: %w", g.cfg.Pin, err)
+	}
+	if !active {
+		return ErrNotConfirmed
+	}
+
+	// Stop does not cancel a callback that already fired and is waiting for
+	// the lock, so the callback checks that it still belongs to the latest
+	// unlock before releasing the relay.
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.timer != timer {
+			return
+		}
+		if err := g.write(false); err != nil {
+			log.Printf("ERROR: failed to release relay on gpio %d for door %s: %v", g.cfg.Pin, doorID, err)
+		}
+		g.timer = nil
+	})
+	g.timer = timer
+
+	return nil
+}
+
+func (g *GPIO) Status(ctx context.Context, doorID string) (State, error) {
+	active, err := g.read()
+	if err != nil {
+		return StateUnknown, err
+	}
+	if active {
+		return StateUnlocked, nil
+	}
+	return StateLocked, nil
+}
@@ -0,0 +1,183 @@
+package actuator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type HomeAssistantConfig struct {
+	BaseURL        string `json:"base_url"`
+	Token          string `json:"token"`
+	EntityID       string `json:"entity_id"`
+	Code           string `json:"code,omitempty"`
+	Relock         bool   `json:"relock,omitempty"`
+	ConfirmSeconds int    `json:"confirm_seconds,omitempty"`
+}
+
+// HomeAssistant unlocks a lock entity through the Home Assistant REST API and
+// polls the entity state until it reports unlocked.
+type HomeAssistant struct {
+	cfg     HomeAssistantConfig
+	client  *http.Client
+	confirm time.Duration
+
+	mu     sync.Mutex
+	relock map[string]*time.Timer
+}
+
+func NewHomeAssistant(cfg HomeAssistantConfig) (*HomeAssistant, error) {
+	if cfg.BaseURL == "" || cfg.Token == "" || cfg.EntityID == "" {
+		return nil, errors.New("home assistant actuator requires a base URL, token and lock entity")
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+
+	confirm := time.Duration(cfg.ConfirmSeconds) * time.Second
+	if confirm <= 0 {
+		confirm = 5 * time.Second
+	}
+
+	return &HomeAssistant{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		confirm: confirm,
+		relock:  make(map[string]*time.Timer),
+	}, nil
+}
+
+func (ha *HomeAssistant) entity(doorID string) string {
+	return strings.ReplaceAll(ha.cfg.EntityID, "{door}", doorID)
+}
+
+func (ha *HomeAssistant) request(ctx context.Context, method, path string, payload interface{}) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, ha.cfg.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+ha.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ha.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("home assistant responded %s", resp.Status)
+	}
+	return respBody, nil
+}
+
+func (ha *HomeAssistant) callLockService(ctx context.Context, service, entityID string) error {
+	payload := map[string]string{"entity_id": entityID}
+	if ha.cfg.Code != "" {
+		payload["code"] = ha.cfg.Code
+	}
+	_, err := ha.request(ctx, http.MethodPost, "/api/services/lock/"+service, payload)
+	return err
+}
+
+func (ha *HomeAssistant) Unlock(ctx context.Context, doorID string, duration time.Duration) error {
+	entityID := ha.entity(doorID)
+
+	if err := ha.callLockService(ctx, "unlock", entityID); err != nil {
+		return fmt.Errorf("call lock.unlock on %s: %w", entityID, err)
+	}
+
+	deadline := time.Now().Add(ha.confirm)
+	for {
+		state, err := ha.Status(ctx, doorID)
+		if err == nil && state == StateUnlocked {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s did not report unlocked", ErrNotConfirmed, entityID)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	if ha.cfg.Relock {
+		ha.scheduleRelock(entityID, duration)
+	}
+
+	return nil
+}
+
+// scheduleRelock keeps one relock timer per entity, so a repeat unlock
+// pushes the relock back instead of being cut short by an earlier one.
+func (ha *HomeAssistant) scheduleRelock(entityID string, duration time.Duration) {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
+	if t := ha.relock[entityID]; t != nil {
+		t.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		ha.mu.Lock()
+		current := ha.relock[entityID] == timer
+		if current {
+			delete(ha.relock, entityID)
+		}
+		ha.mu.Unlock()
+		if !current {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := ha.callLockService(ctx, "lock", entityID); err != nil {
+			log.Printf("ERROR: failed to relock %s: %v", entityID, err)
+		}
+	})
+	ha.relock[entityID] = timer
+}
+
+func (ha *HomeAssistant) Status(ctx context.Context, doorID string) (State, error) {
+	body, err := ha.request(ctx, http.MethodGet, "/api/states/"+ha.entity(doorID), nil)
+	if err != nil {
+		return StateUnknown, err
+	}
+
+	var entity struct {
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(body, &entity); err != nil {
+		return StateUnknown, err
+	}
+
+	switch entity.State {
+	case "unlocked", "open":
+		return StateUnlocked, nil
+	case "locked":
+		return StateLocked, nil
+	default:
+		return StateUnknown, nil
+	}
+}
@@ -0,0 +1,52 @@
+package actuator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHomeAssistantRepeatUnlockResetsRelock(t *testing.T) {
+	var locks atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/services/lock/unlock", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /api/services/lock/lock", func(w http.ResponseWriter, r *http.Request) {
+		locks.Add(1)
+	})
+	mux.HandleFunc("GET /api/states/lock.front", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"state":"unlocked"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ha, err := NewHomeAssistant(HomeAssistantConfig{
+		BaseURL:  srv.URL,
+		Token:    "token",
+		EntityID: "lock.{door}",
+		Relock:   true,
+	})
+	if err != nil {
+		t.Fatalf("NewHomeAssistant: %v", err)
+	}
+
+	duration := 200 * time.Millisecond
+	if err := ha.Unlock(context.Background(), "front", duration); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	time.Sleep(duration / 2)
+	if err := ha.Unlock(context.Background(), "front", duration); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	time.Sleep(duration * 3 / 4)
+	if n := locks.Load(); n != 0 {
+		t.Fatalf("relocked %d times before the second unlock window ended", n)
+	}
+	time.Sleep(duration)
+	if n := locks.Load(); n != 1 {
+		t.Errorf("relocked %d times, want 1", n)
+	}
+}
@@ -0,0 +1,120 @@
+package actuator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type HTTPRelayConfig struct {
+	UnlockURL      string `json:"unlock_url"`
+	StatusURL      string `json:"status_url,omitempty"`
+	Method         string `json:"method,omitempty"`
+	Token          string `json:"token,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+// HTTPRelay drives a network relay board (Shelly, Tasmota, ESPHome and the
+// like). A 2xx response to the unlock request is treated as confirmation.
+type HTTPRelay struct {
+	cfg    HTTPRelayConfig
+	client *http.Client
+}
+
+func NewHTTPRelay(cfg HTTPRelayConfig) (*HTTPRelay, error) {
+	if cfg.UnlockURL == "" {
+		return nil, errors.New("http actuator requires an unlock URL")
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &HTTPRelay{
+		cfg:    cfg,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (h *HTTPRelay) do(ctx context.Context, method, rawURL, doorID string, duration time.Duration) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("door", doorID)
+	if duration > 0 {
+		q.Set("duration", strconv.Itoa(int(duration.Seconds())))
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.cfg.Token)
+	}
+	return h.client.Do(req)
+}
+
+func (h *HTTPRelay) Unlock(ctx context.Context, doorID string, duration time.Duration) error {
+	resp, err := h.do(ctx, h.cfg.Method, h.cfg.UnlockURL, doorID, duration)
+	if err != nil {
+		return fmt.Errorf("relay request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: relay responded %s", ErrNotConfirmed, resp.Status)
+	}
+	return nil
+}
+
+func (h *HTTPRelay) Status(ctx context.Context, doorID string) (State, error) {
+	if h.cfg.StatusURL == "" {
+		return StateUnknown, nil
+	}
+
+	resp, err := h.do(ctx, http.MethodGet, h.cfg.StatusURL, doorID, 0)
+	if err != nil {
+		return StateUnknown, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return StateUnknown, fmt.Errorf("relay status responded %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return StateUnknown, err
+	}
+
+	var payload struct {
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		payload.State = string(body)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(payload.State)) {
+	case "unlocked", "on", "open", "1", "true":
+		return StateUnlocked, nil
+	case "locked", "off", "closed", "0", "false":
+		return StateLocked, nil
+	default:
+		return StateUnknown, nil
+	}
+}
@@ -0,0 +1,336 @@
+package actuator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type MQTTConfig struct {
+	Broker         string `json:"broker"`
+	ClientID       string `json:"client_id,omitempty"`
+	Username       string `json:"username,omitempty"`
+	Password       string `json:"password,omitempty"`
+	CommandTopic   string `json:"command_topic"`
+	StateTopic     string `json:"state_topic"`
+	UnlockPayload  string `json:"unlock_payload,omitempty"`
+	AckPayload     string `json:"ack_payload,omitempty"`
+	QoS            int    `json:"qos,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+	Retries        int    `json:"retries,omitempty"`
+}
+
+// MQTT publishes unlock commands to a lock or relay controller and waits for
+// the controller to report the unlocked state before confirming.
+//
+// Topics and the unlock payload may contain {door} and {duration}
+// placeholders. Without an explicit unlock payload a JSON command carrying a
+// request_id is sent; controllers that echo the request_id in their state
+// message are matched exactly, anything else is matched on the ack payload.
+type MQTT struct {
+	cfg     MQTTConfig
+	client  mqtt.Client
+	timeout time.Duration
+	budget  time.Duration
+
+	mu      sync.Mutex
+	states  map[string]State
+	waiters map[string][]chan mqttAck
+}
+
+type mqttAck struct {
+	state     State
+	requestID string
+}
+
+func NewMQTT(cfg MQTTConfig) (*MQTT, error) {
+	if cfg.Broker == "" {
+		return nil, errors.New("mqtt actuator requires a broker URL")
+	}
+
+	m, err := newMQTT(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(m.cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectTimeout(m.timeout).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			if err := m.subscribe(c); err != nil {
+				log.Printf("ERROR: mqtt actuator failed to subscribe to %s: %v", m.cfg.StateTopic, err)
+			}
+		}).
+		SetConnectionLostHandler(func(c mqtt.Client, err error) {
+			log.Printf("WARNING: mqtt actuator lost connection to %s: %v", cfg.Broker, err)
+		})
+
+	m.client = mqtt.NewClient(opts)
+	token := m.client.Connect()
+	if !token.WaitTimeout(m.timeout) {
+		log.Printf("WARNING: mqtt broker %s not reachable yet, will keep retrying in the background", cfg.Broker)
+	} else if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("connect to mqtt broker %s: %w", cfg.Broker, err)
+	}
+
+	return m, nil
+}
+
+// NewMQTTWithClient wires the actuator to an already connected client, which
+// lets it run against an in-process broker or a stub client.
+func NewMQTTWithClient(cfg MQTTConfig, client mqtt.Client) (*MQTT, error) {
+	m, err := newMQTT(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.client = client
+	if err := m.subscribe(client); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func newMQTT(cfg MQTTConfig) (*MQTT, error) {
+	if cfg.CommandTopic == "" || cfg.StateTopic == "" {
+		return nil, errors.New("mqtt actuator requires a command and a state topic")
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "door-control-" + randomHex(4)
+	}
+	if cfg.AckPayload == "" {
+		cfg.AckPayload = "unlocked"
+	}
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		cfg.QoS = 1
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	// Every attempt may wait the full timeout, and all of them have to be
+	// over before the caller gives up on Unlock.
+	budget := timeout * time.Duration(cfg.Retries+1)
+	if budget > MaxUnlockTime {
+		return nil, fmt.Errorf("mqtt actuator: %d attempts of %s take longer than the %s an unlock may take; lower timeout_seconds or retries",
+			cfg.Retries+1, timeout, MaxUnlockTime)
+	}
+
+	return &MQTT{
+		cfg:     cfg,
+		timeout: timeout,
+		budget:  budget,
+		states:  make(map[string]State),
+		waiters: make(map[string][]chan mqttAck),
+	}, nil
+}
+
+func (m *MQTT) subscribe(c mqtt.Client) error {
+	filter := strings.ReplaceAll(m.cfg.StateTopic, "{door}", "+")
+	token := c.Subscribe(filter, byte(m.cfg.QoS), m.handleState)
+	if !token.WaitTimeout(m.timeout) {
+		return errors.New("subscribe timed out")
+	}
+	return token.Error()
+}
+
+func (m *MQTT) handleState(_ mqtt.Client, msg mqtt.Message) {
+	doorID, ok := topicDoor(m.cfg.StateTopic, msg.Topic())
+	if !ok {
+		return
+	}
+
+	ack := m.parseState(msg.Payload())
+
+	m.mu.Lock()
+	m.states[doorID] = ack.state
+	var waiters []chan mqttAck
+	if doorID == "" {
+		// a state topic without {door} serves every door on this controller
+		for _, w := range m.waiters {
+			waiters = append(waiters, w...)
+		}
+	} else {
+		waiters = append(waiters, m.waiters[doorID]...)
+	}
+	m.mu.Unlock()
+
+	for _, ch := range waiters {
+		select {
+		case ch <- ack:
+		default:
+		}
+	}
+}
+
+func (m *MQTT) parseState(payload []byte) mqttAck {
+	var ack mqttAck
+	raw := strings.TrimSpace(string(payload))
+
+	var msg struct {
+		State     string `json:"state"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(payload, &msg); err == nil && msg.State != "" {
+		raw = msg.State
+		ack.requestID = msg.RequestID
+	}
+
+	switch {
+	case strings.EqualFold(raw, m.cfg.AckPayload), strings.EqualFold(raw, string(StateUnlocked)):
+		ack.state = StateUnlocked
+	case strings.EqualFold(raw, string(StateLocked)):
+		ack.state = StateLocked
+	default:
+		ack.state = StateUnknown
+	}
+	return ack
+}
+
+func (m *MQTT) addWaiter(doorID string) chan mqttAck {
+	ch := make(chan mqttAck, 4)
+	m.mu.Lock()
+	m.waiters[doorID] = append(m.waiters[doorID], ch)
+	m.mu.Unlock()
+	return ch
+}
+
+func (m *MQTT) removeWaiter(doorID string, ch chan mqttAck) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	waiters := m.waiters[doorID]
+	for i, w := range waiters {
+		if w == ch {
+			m.waiters[doorID] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(m.waiters[doorID]) == 0 {
+		delete(m.waiters, doorID)
+	}
+}
+
+func (m *MQTT) commandPayload(doorID string, duration time.Duration, requestID string) []byte {
+	seconds := strconv.Itoa(int(duration.Seconds()))
+	if m.cfg.UnlockPayload != "" {
+		return []byte(strings.NewReplacer("{door}", doorID, "{duration}", seconds).Replace(m.cfg.UnlockPayload))
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"action":     "unlock",
+		"door":       doorID,
+		"duration":   int(duration.Seconds()),
+		"request_id": requestID,
+	})
+	return payload
+}
+
+func (m *MQTT) Unlock(ctx context.Context, doorID string, duration time.Duration) error {
+	if !m.client.IsConnectionOpen() {
+		return errors.New("mqtt broker not connected")
+	}
+
+	topic := strings.ReplaceAll(m.cfg.CommandTopic, "{door}", doorID)
+	ch := m.addWaiter(doorID)
+	defer m.removeWaiter(doorID, ch)
+
+	deadline := time.Now().Add(m.budget)
+	for attempt := 0; attempt <= m.cfg.Retries; attempt++ {
+		if time.Until(deadline) <= 0 {
+			log.Printf("mqtt actuator: giving up on door %s after %s (attempt %d)", doorID, m.budget, attempt+1)
+			break
+		}
+		requestID := randomHex(8)
+		token := m.client.Publish(topic, byte(m.cfg.QoS), false, m.commandPayload(doorID, duration, requestID))
+		if !token.WaitTimeout(min(m.timeout, time.Until(deadline))) {
+			log.Printf("mqtt actuator: publish to %s timed out (attempt %d)", topic, attempt+1)
+			continue
+		}
+		if err := token.Error(); err != nil {
+			log.Printf("mqtt actuator: publish to %s failed (attempt %d): %v", topic, attempt+1, err)
+			continue
+		}
+
+		timer := time.NewTimer(min(m.timeout, time.Until(deadline)))
+	wait:
+		for {
+			select {
+			case ack := <-ch:
+				if ack.state != StateUnlocked {
+					continue
+				}
+				if ack.requestID != "" && ack.requestID != requestID {
+					continue
+				}
+				timer.Stop()
+				return nil
+			case <-timer.C:
+				log.Printf("mqtt actuator: no acknowledgement on %s for door %s (attempt %d)", m.cfg.StateTopic, doorID, attempt+1)
+				break wait
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+	}
+
+	return ErrNotConfirmed
+}
+
+func (m *MQTT) Status(ctx context.Context, doorID string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if state, ok := m.states[doorID]; ok {
+		return state, nil
+	}
+	if state, ok := m.states[""]; ok {
+		return state, nil
+	}
+	return StateUnknown, nil
+}
+
+// topicDoor matches topic against a template that may contain a {door}
+// segment and returns the door ID found in that position.
+func topicDoor(template, topic string) (string, bool) {
+	tParts := strings.Split(template, "/")
+	parts := strings.Split(topic, "/")
+	if len(tParts) != len(parts) {
+		return "", false
+	}
+
+	doorID := ""
+	for i, p := range tParts {
+		if p == "{door}" {
+			doorID = parts[i]
+			continue
+		}
+		if p != parts[i] {
+			return "", false
+		}
+	}
+	return doorID, true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
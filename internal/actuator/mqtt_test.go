@@ -0,0 +1,266 @@
+package actuator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeClient stands in for a broker connection. Every publish is recorded
+// and handed to reply, which plays the door controller.
+type fakeClient struct {
+	mqtt.Client
+
+	mu      sync.Mutex
+	handler mqtt.MessageHandler
+	publish []string
+	reply   func(c *fakeClient, attempt int, payload []byte)
+	closed  bool
+}
+
+func (c *fakeClient) IsConnectionOpen() bool { return !c.closed }
+
+func (c *fakeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mu.Lock()
+	c.handler = callback
+	c.mu.Unlock()
+	return &fakeToken{}
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	c.publish = append(c.publish, topic)
+	attempt := len(c.publish)
+	c.mu.Unlock()
+	if c.reply != nil {
+		go c.reply(c, attempt, payload.([]byte))
+	}
+	return &fakeToken{}
+}
+
+func (c *fakeClient) state(topic, payload string) {
+	c.mu.Lock()
+	handler := c.handler
+	c.mu.Unlock()
+	handler(c, &fakeMessage{topic: topic, payload: []byte(payload)})
+}
+
+func (c *fakeClient) published() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.publish)
+}
+
+type fakeToken struct {
+	err error
+}
+
+func (t *fakeToken) Wait() bool                     { return true }
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t *fakeToken) Error() error                   { return t.err }
+
+func (t *fakeToken) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+type fakeMessage struct {
+	mqtt.Message
+	topic   string
+	payload []byte
+}
+
+func (m *fakeMessage) Topic() string   { return m.topic }
+func (m *fakeMessage) Payload() []byte { return m.payload }
+
+// ackRequest echoes the request_id of a JSON unlock command.
+func ackRequest(c *fakeClient, payload []byte) {
+	var cmd struct {
+		RequestID string `json:"request_id"`
+	}
+	json.Unmarshal(payload, &cmd)
+	c.state("doors/front/state", `{"state":"unlocked","request_id":"`+cmd.RequestID+`"}`)
+}
+
+func newTestMQTT(t *testing.T, client *fakeClient, retries int) *MQTT {
+	t.Helper()
+	m, err := NewMQTTWithClient(MQTTConfig{
+		CommandTopic: "doors/{door}/set",
+		StateTopic:   "doors/{door}/state",
+		Retries:      retries,
+	}, client)
+	if err != nil {
+		t.Fatalf("NewMQTTWithClient: %v", err)
+	}
+	m.timeout = 50 * time.Millisecond
+	m.budget = m.timeout * time.Duration(retries+1)
+	return m
+}
+
+func TestMQTTUnlockAck(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func(c *fakeClient, attempt int, payload []byte)
+	}{
+		{"matching request id", func(c *fakeClient, _ int, payload []byte) {
+			ackRequest(c, payload)
+		}},
+		{"ack payload without request id", func(c *fakeClient, _ int, _ []byte) {
+			c.state("doors/front/state", "unlocked")
+		}},
+		{"stale ack then matching one", func(c *fakeClient, _ int, payload []byte) {
+			c.state("doors/front/state", `{"state":"unlocked","request_id":"other"}`)
+			c.state("doors/back/state", "unlocked")
+			ackRequest(c, payload)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{reply: tt.reply}
+			m := newTestMQTT(t, client, 0)
+			if err := m.Unlock(context.Background(), "front", 5*time.Second); err != nil {
+				t.Fatalf("Unlock: %v", err)
+			}
+			if n := client.published(); n != 1 {
+				t.Errorf("published %d commands, want 1", n)
+			}
+			if state, _ := m.Status(context.Background(), "front"); state != StateUnlocked {
+				t.Errorf("Status = %s, want %s", state, StateUnlocked)
+			}
+		})
+	}
+}
+
+func TestMQTTUnlockTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func(c *fakeClient, attempt int, payload []byte)
+	}{
+		{"no reply", nil},
+		{"wrong request id", func(c *fakeClient, _ int, _ []byte) {
+			c.state("doors/front/state", `{"state":"unlocked","request_id":"other"}`)
+		}},
+		{"reports locked", func(c *fakeClient, _ int, _ []byte) {
+			c.state("doors/front/state", "locked")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{reply: tt.reply}
+			m := newTestMQTT(t, client, 0)
+			err := m.Unlock(context.Background(), "front", 5*time.Second)
+			if !errors.Is(err, ErrNotConfirmed) {
+				t.Fatalf("Unlock error = %v, want %v", err, ErrNotConfirmed)
+			}
+		})
+	}
+}
+
+func TestMQTTUnlockRetry(t *testing.T) {
+	client := &fakeClient{reply: func(c *fakeClient, attempt int, payload []byte) {
+		if attempt == 3 {
+			ackRequest(c, payload)
+		}
+	}}
+	m := newTestMQTT(t, client, 2)
+	if err := m.Unlock(context.Background(), "front", 5*time.Second); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if n := client.published(); n != 3 {
+		t.Errorf("published %d commands, want 3", n)
+	}
+}
+
+func TestMQTTUnlockRetriesExhausted(t *testing.T) {
+	client := &fakeClient{}
+	m := newTestMQTT(t, client, 2)
+	err := m.Unlock(context.Background(), "front", 5*time.Second)
+	if !errors.Is(err, ErrNotConfirmed) {
+		t.Fatalf("Unlock error = %v, want %v", err, ErrNotConfirmed)
+	}
+	if n := client.published(); n != 3 {
+		t.Errorf("published %d commands, want 3", n)
+	}
+}
+
+func TestMQTTBudgetFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout int
+		retries int
+		budget  time.Duration
+		wantErr bool
+	}{
+		{"defaults", 0, 0, 3 * time.Second, false},
+		{"default timeout with retries", 0, 2, 9 * time.Second, false},
+		{"fits exactly", 5, 1, 10 * time.Second, false},
+		{"too many retries", 3, 3, 0, true},
+		{"timeout too long", 11, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMQTTWithClient(MQTTConfig{
+				CommandTopic:   "doors/{door}/set",
+				StateTopic:     "doors/{door}/state",
+				TimeoutSeconds: tt.timeout,
+				Retries:        tt.retries,
+			}, &fakeClient{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("config with a budget over %s was accepted", MaxUnlockTime)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewMQTTWithClient: %v", err)
+			}
+			if m.budget != tt.budget {
+				t.Errorf("budget = %s, want %s", m.budget, tt.budget)
+			}
+		})
+	}
+}
+
+func TestMQTTUnlockBudget(t *testing.T) {
+	client := &fakeClient{}
+	m := newTestMQTT(t, client, 2)
+	m.budget = 80 * time.Millisecond
+
+	start := time.Now()
+	err := m.Unlock(context.Background(), "front", 5*time.Second)
+	if !errors.Is(err, ErrNotConfirmed) {
+		t.Fatalf("Unlock error = %v, want %v", err, ErrNotConfirmed)
+	}
+	if elapsed := time.Since(start); elapsed > m.budget+50*time.Millisecond {
+		t.Errorf("Unlock took %s, want at most about %s", elapsed, m.budget)
+	}
+	if n := client.published(); n > 2 {
+		t.Errorf("published %d commands within the budget, want at most 2", n)
+	}
+}
+
+func TestMQTTUnlockNotConnected(t *testing.T) {
+	client := &fakeClient{closed: true}
+	m := newTestMQTT(t, client, 2)
+	if err := m.Unlock(context.Background(), "front", 5*time.Second); err == nil {
+		t.Fatal("Unlock succeeded without a broker connection")
+	}
+	if n := client.published(); n != 0 {
+		t.Errorf("published %d commands, want 0", n)
+	}
+}
+
+func TestMQTTUnlockCancelled(t *testing.T) {
+	m := newTestMQTT(t, &fakeClient{}, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Unlock(ctx, "front", 5*time.Second); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Unlock error = %v, want %v", err, context.Canceled)
+	}
+}
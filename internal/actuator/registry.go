@@ -0,0 +1,90 @@
+package actuator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DriverDefault in a door's actuator config selects the process-wide
+// default actuator.
+const DriverDefault = "default"
+
+// ErrNotConfigured is returned for a door that has no actuator config while
+// the default actuator is shared by several doors.
+var ErrNotConfigured = errors.New("door has no actuator configured")
+
+// Registry hands out one actuator per door, built from the door's own
+// configuration or the process-wide default. Actuators are cached so
+// long-lived connections (MQTT) are shared between requests.
+//
+// The default actuator drives a single relay or lock, so a door without a
+// config only gets it while it is the only door. With more doors each one
+// must have its own config or opt in with {"driver": "default"}, otherwise
+// unlocking a room would open whatever the default is wired to.
+type Registry struct {
+	mu        sync.Mutex
+	fallback  entry
+	doors     map[string]entry
+	doorCount int
+}
+
+type entry struct {
+	raw      string
+	actuator DoorActuator
+	duration time.Duration
+}
+
+func NewRegistry(fallback Config) (*Registry, error) {
+	act, err := New(fallback)
+	if err != nil {
+		return nil, err
+	}
+	return &Registry{
+		fallback: entry{actuator: act, duration: fallback.UnlockDuration()},
+		doors:    make(map[string]entry),
+	}, nil
+}
+
+// SetDoorCount tells the registry how many doors exist, which decides
+// whether doors without a config may use the default actuator.
+func (r *Registry) SetDoorCount(n int) {
+	r.mu.Lock()
+	r.doorCount = n
+	r.mu.Unlock()
+}
+
+func (r *Registry) ForDoor(doorID string, raw json.RawMessage) (DoorActuator, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(raw) == 0 {
+		if r.doorCount > 1 {
+			return nil, 0, fmt.Errorf("door %s: %w", doorID, ErrNotConfigured)
+		}
+		return r.fallback.actuator, r.fallback.duration, nil
+	}
+
+	if e, ok := r.doors[doorID]; ok && e.raw == string(raw) {
+		return e.actuator, e.duration, nil
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, 0, fmt.Errorf("invalid actuator config for door %s: %w", doorID, err)
+	}
+	if strings.EqualFold(cfg.Driver, DriverDefault) {
+		return r.fallback.actuator, r.fallback.duration, nil
+	}
+	act, err := New(cfg)
+	if err != nil {
+		return nil, 0, fmt.Errorf("create actuator for door %s: %w", doorID, err)
+	}
+
+	e := entry{raw: string(raw), actuator: act, duration: cfg.UnlockDuration()}
+	r.doors[doorID] = e
+	return e.actuator, e.duration, nil
+}
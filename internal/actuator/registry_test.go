@@ -0,0 +1,42 @@
+package actuator
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRegistryFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		doors    int
+		raw      string
+		fallback bool
+		err      error
+	}{
+		{"single door without config", 1, "", true, nil},
+		{"several doors without config", 3, "", false, ErrNotConfigured},
+		{"several doors opting in", 3, `{"driver":"default"}`, true, nil},
+		{"several doors with own config", 3, `{"driver":"simulated"}`, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRegistry(Config{})
+			if err != nil {
+				t.Fatalf("NewRegistry: %v", err)
+			}
+			r.SetDoorCount(tt.doors)
+
+			act, _, err := r.ForDoor("2", json.RawMessage(tt.raw))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ForDoor error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got := act == r.fallback.actuator; got != tt.fallback {
+				t.Errorf("got default actuator = %v, want %v", got, tt.fallback)
+			}
+		})
+	}
+}
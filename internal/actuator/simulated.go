@@ -0,0 +1,66 @@
+package actuator
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Simulated keeps lock state in memory. It is the default driver so the
+// application can run without any hardware attached.
+type Simulated struct {
+	mu     sync.Mutex
+	states map[string]State
+	timers map[string]*time.Timer
+}
+
+func NewSimulated() *Simulated {
+	return &Simulated{
+		states: make(map[string]State),
+		timers: make(map[string]*time.Timer),
+	}
+}
+
+func (s *Simulated) Unlock(ctx context.Context, doorID string, duration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.timers[doorID]; ok {
+		t.Stop()
+	}
+
+	s.states[doorID] = StateUnlocked
+	// Stop does not cancel a callback that already fired and is waiting for
+	// the lock, so the callback checks that it still belongs to the latest
+	// unlock before locking the door.
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.timers[doorID] != timer {
+			return
+		}
+		s.states[doorID] = StateLocked
+		delete(s.timers, doorID)
+		log.Printf("[simulated actuator] door %s locked again", doorID)
+	})
+	s.timers[doorID] = timer
+
+	log.Printf("[simulated actuator] door %s unlocked for %s", doorID, duration)
+	return nil
+}
+
+func (s *Simulated) Status(ctx context.Context, doorID string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state, ok := s.states[doorID]; ok {
+		return state, nil
+	}
+	return StateLocked, nil
+}
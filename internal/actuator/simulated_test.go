@@ -0,0 +1,51 @@
+package actuator
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSimulatedRelocks(t *testing.T) {
+	s := NewSimulated()
+	if err := s.Unlock(context.Background(), "front", 20*time.Millisecond); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if state, _ := s.Status(context.Background(), "front"); state != StateUnlocked {
+		t.Fatalf("Status = %s, want %s", state, StateUnlocked)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if state, _ := s.Status(context.Background(), "front"); state != StateLocked {
+		t.Errorf("Status = %s, want %s", state, StateLocked)
+	}
+}
+
+// A callback that already fired and is waiting for the lock when the door
+// is unlocked again must not lock it early.
+func TestSimulatedStaleRelock(t *testing.T) {
+	s := NewSimulated()
+	if err := s.Unlock(context.Background(), "front", time.Millisecond); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	s.mu.Lock()
+	time.Sleep(20 * time.Millisecond)
+	// The callback is now blocked on s.mu. Unlock again the way Unlock
+	// does, with a timer that has not fired yet.
+	s.timers["front"].Stop()
+	s.states["front"] = StateUnlocked
+	next := time.AfterFunc(time.Hour, func() {})
+	defer next.Stop()
+	s.timers["front"] = next
+	s.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	if state, _ := s.Status(context.Background(), "front"); state != StateUnlocked {
+		t.Errorf("Status = %s, want %s", state, StateUnlocked)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timers["front"] != next {
+		t.Errorf("the stale callback removed the current relock timer")
+	}
+}
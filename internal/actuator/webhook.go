@@ -0,0 +1,154 @@
+package actuator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type WebhookConfig struct {
+	URL            string            `json:"url"`
+	Method         string            `json:"method,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	BearerToken    string            `json:"bearer_token,omitempty"`
+	BodyTemplate   string            `json:"body_template,omitempty"`
+	ContentType    string            `json:"content_type,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+}
+
+type webhookData struct {
+	DoorID   string
+	Action   string
+	Duration int
+}
+
+// Webhook calls an arbitrary HTTP endpoint to unlock the door. The URL and
+// body are Go templates receiving .DoorID, .Action and .Duration (seconds).
+// Templates do no escaping of their own: JSON bodies should quote values
+// with the json function, e.g. {"door":{{json .DoorID}}}, and a JSON body
+// that does not parse is never sent.
+type Webhook struct {
+	cfg    WebhookConfig
+	url    *template.Template
+	body   *template.Template
+	client *http.Client
+}
+
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("webhook actuator requires a URL")
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+	}
+
+	urlTmpl, err := template.New("url").Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse webhook URL template: %w", err)
+	}
+	bodyTmpl, err := template.New("body").Funcs(template.FuncMap{"json": jsonValue}).Parse(cfg.BodyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("parse webhook body template: %w", err)
+	}
+
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &Webhook{
+		cfg:    cfg,
+		url:    urlTmpl,
+		body:   bodyTmpl,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (wh *Webhook) Unlock(ctx context.Context, doorID string, duration time.Duration) error {
+	data := webhookData{DoorID: doorID, Action: "unlock", Duration: int(duration.Seconds())}
+
+	var u, body bytes.Buffer
+	if err := wh.url.Execute(&u, data); err != nil {
+		return fmt.Errorf("render webhook URL: %w", err)
+	}
+	if err := wh.body.Execute(&body, data); err != nil {
+		return fmt.Errorf("render webhook body: %w", err)
+	}
+
+	var reqBody io.Reader
+	if body.Len() > 0 {
+		if isJSON(wh.cfg.ContentType) && !json.Valid(body.Bytes()) {
+			return fmt.Errorf("webhook body for door %s is not valid JSON", doorID)
+		}
+		reqBody = &body
+	}
+
+	req, err := http.NewRequestWithContext(ctx, wh.cfg.Method, u.String(), reqBody)
+	if err != nil {
+		return err
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", wh.cfg.ContentType)
+	}
+	if wh.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+wh.cfg.BearerToken)
+	}
+	for k, v := range wh.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: webhook responded %s", ErrNotConfirmed, resp.Status)
+	}
+	return nil
+}
+
+func (wh *Webhook) Status(ctx context.Context, doorID string) (State, error) {
+	return StateUnknown, nil
+}
+
+// jsonValue encodes v as a JSON value, quoting and escaping strings.
+func jsonValue(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	return string(raw), err
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// parseHeaders turns "Name: value; Other: value" into a header map.
+func parseHeaders(raw string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(raw, ";") {
+		name, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+	return headers
+}
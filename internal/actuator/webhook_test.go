@@ -0,0 +1,59 @@
+package actuator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookJSONBody(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("body %q is not JSON: %v", body, err)
+		}
+	}))
+	defer srv.Close()
+
+	wh, err := NewWebhook(WebhookConfig{
+		URL:          srv.URL,
+		BodyTemplate: `{"door":{{json .DoorID}},"action":{{json .Action}},"seconds":{{.Duration}}}`,
+	})
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+	door := `front", "action": "lock`
+	if err := wh.Unlock(context.Background(), door, 5*time.Second); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if got["door"] != door || got["action"] != "unlock" || got["seconds"] != float64(5) {
+		t.Errorf("body = %v", got)
+	}
+}
+
+func TestWebhookRefusesInvalidJSON(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	wh, err := NewWebhook(WebhookConfig{
+		URL:          srv.URL,
+		BodyTemplate: `{"door":"{{.DoorID}}"}`,
+	})
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+	if err := wh.Unlock(context.Background(), `front"`, 5*time.Second); err == nil {
+		t.Fatal("Unlock sent a body that is not valid JSON")
+	}
+	if called {
+		t.Error("webhook was called")
+	}
+}
@@ -0,0 +1,191 @@
+// Package attestation decides which authenticators may register passkeys,
+// based on the attestation they present and FIDO Metadata Service (MDS)
+// data loaded from a local file.
+package attestation
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"door-control/internal/aaguid"
+
+	"github.com/go-webauthn/webauthn/metadata"
+	"github.com/go-webauthn/webauthn/metadata/providers/memory"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// ErrNotAllowed is wrapped by every error Check returns.
+var ErrNotAllowed = errors.New("authenticator not allowed")
+
+type Policy struct {
+	// Direct requests attestation from authenticators and rejects passkeys
+	// that come without one. The attestation itself is verified by the
+	// WebAuthn library against the metadata in MDS.
+	Direct bool
+	MDS    metadata.Provider
+	// Allowed holds the AAGUIDs that may register. Empty allows all.
+	Allowed   map[string]bool
+	RequireUV bool
+}
+
+// PolicyFromEnv reads ATTESTATION_POLICY ("none" or "direct"),
+// ATTESTATION_MDS_FILE, AUTHENTICATOR_ALLOWLIST (comma-separated AAGUIDs)
+// and REQUIRE_USER_VERIFICATION.
+func PolicyFromEnv() (*Policy, error) {
+	p := &Policy{
+		Allowed:   map[string]bool{},
+		RequireUV: os.Getenv("REQUIRE_USER_VERIFICATION") == "true",
+	}
+
+	switch mode := os.Getenv("ATTESTATION_POLICY"); mode {
+	case "", "none":
+	case "direct":
+		p.Direct = true
+	default:
+		return nil, fmt.Errorf("unknown attestation policy %q", mode)
+	}
+
+	for _, id := range strings.Split(os.Getenv("AUTHENTICATOR_ALLOWLIST"), ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" {
+			continue
+		}
+		if aaguid.String(parseUUID(id)) != id {
+			return nil, fmt.Errorf("invalid AAGUID %q in AUTHENTICATOR_ALLOWLIST", id)
+		}
+		p.Allowed[id] = true
+	}
+
+	if path := os.Getenv("ATTESTATION_MDS_FILE"); path != "" {
+		mds, err := LoadMDS(path, p.Direct)
+		if err != nil {
+			return nil, err
+		}
+		p.MDS = mds
+	} else if p.Direct {
+		return nil, errors.New("ATTESTATION_POLICY=direct needs ATTESTATION_MDS_FILE")
+	}
+
+	// Without verified attestation the AAGUID is whatever the authenticator
+	// claims, so an allow-list would be trivially bypassed.
+	if len(p.Allowed) > 0 && (!p.Direct || p.MDS == nil) {
+		return nil, errors.New("AUTHENTICATOR_ALLOWLIST needs ATTESTATION_POLICY=direct and ATTESTATION_MDS_FILE")
+	}
+
+	return p, nil
+}
+
+// LoadMDS reads a metadata BLOB as downloaded from the FIDO Alliance, checks
+// its signature against the FIDO root certificate and returns a provider
+// for it. With requireEntry set, authenticators that are not listed in the
+// BLOB are rejected. Authenticator descriptions are also registered with
+// the aaguid package so passkey lists can name them.
+func LoadMDS(path string, requireEntry bool) (metadata.Provider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decoder, err := metadata.NewDecoder(metadata.WithIgnoreEntryParsingErrors())
+	if err != nil {
+		return nil, err
+	}
+	payload, err := decoder.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	parsed, err := decoder.Parse(payload)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if next := parsed.Parsed.NextUpdate; !next.IsZero() && next.Before(time.Now()) {
+		log.Printf("WARNING: %s was due for an update on %s, download a fresh copy", path, next.Format("2006-01-02"))
+	}
+
+	entries := parsed.ToMap()
+	names := make(map[string]string, len(entries))
+	for id, entry := range entries {
+		names[id.String()] = entry.MetadataStatement.Description
+	}
+	aaguid.Add(names)
+	log.Printf("Loaded %d authenticators from %s (BLOB #%d)", len(entries), path, parsed.Parsed.Number)
+
+	return memory.New(
+		memory.WithMetadata(entries),
+		memory.WithValidateEntry(requireEntry),
+		memory.WithValidateEntryPermitZeroAAGUID(false),
+		memory.WithValidateTrustAnchor(true),
+		memory.WithValidateStatus(true),
+		memory.WithValidateAttestationTypes(true),
+	)
+}
+
+// Apply configures WebAuthn to ask for what the policy checks.
+func (p *Policy) Apply(cfg *webauthn.Config) {
+	if p.Direct {
+		cfg.AttestationPreference = protocol.PreferDirectAttestation
+	}
+	if p.RequireUV {
+		cfg.AuthenticatorSelection.UserVerification = protocol.VerificationRequired
+	}
+	cfg.MDS = p.MDS
+}
+
+// Check returns an error wrapping ErrNotAllowed if a newly registered
+// credential does not satisfy the policy.
+func (p *Policy) Check(credential *webauthn.Credential) error {
+	if p.Direct && (credential.AttestationType == "" || credential.AttestationType == string(protocol.AttestationFormatNone)) {
+		return fmt.Errorf("%w: no attestation was provided", ErrNotAllowed)
+	}
+	if p.RequireUV && !credential.Flags.UserVerified {
+		return fmt.Errorf("%w: user verification is required", ErrNotAllowed)
+	}
+	if len(p.Allowed) > 0 {
+		id := aaguid.String(credential.Authenticator.AAGUID)
+		if !p.Allowed[id] {
+			if id == "" {
+				return fmt.Errorf("%w: the authenticator did not identify itself", ErrNotAllowed)
+			}
+			return fmt.Errorf("%w: %s is not on the allow-list", ErrNotAllowed, describe(id))
+		}
+	}
+	return nil
+}
+
+// String summarises the policy for the startup log.
+func (p *Policy) String() string {
+	parts := []string{"attestation none"}
+	if p.Direct {
+		parts[0] = "attestation direct"
+	}
+	if p.MDS != nil {
+		parts = append(parts, "MDS loaded")
+	}
+	if len(p.Allowed) > 0 {
+		parts = append(parts, fmt.Sprintf("%d allowed authenticators", len(p.Allowed)))
+	}
+	if p.RequireUV {
+		parts = append(parts, "user verification required")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func describe(id string) string {
+	if name := aaguid.Name(id); name != "" {
+		return fmt.Sprintf("%s (%s)", name, id)
+	}
+	return id
+}
+
+func parseUUID(id string) []byte {
+	raw, _ := hex.DecodeString(strings.ReplaceAll(id, "-", ""))
+	return raw
+}
@@ -0,0 +1,43 @@
+package attestation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyFromEnvAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		mdsFile string
+		wantErr string
+	}{
+		{"allow-list without attestation", "none", "", "AUTHENTICATOR_ALLOWLIST needs"},
+		{"allow-list with default policy", "", "", "AUTHENTICATOR_ALLOWLIST needs"},
+		{"direct without MDS file", "direct", "", "needs ATTESTATION_MDS_FILE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ATTESTATION_POLICY", tt.policy)
+			t.Setenv("ATTESTATION_MDS_FILE", tt.mdsFile)
+			t.Setenv("AUTHENTICATOR_ALLOWLIST", "cb69481e-8ff7-4039-93ec-0a2729a154a8")
+			_, err := PolicyFromEnv()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("PolicyFromEnv error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyFromEnvWithoutAllowlist(t *testing.T) {
+	t.Setenv("ATTESTATION_POLICY", "none")
+	t.Setenv("ATTESTATION_MDS_FILE", "")
+	t.Setenv("AUTHENTICATOR_ALLOWLIST", "")
+	p, err := PolicyFromEnv()
+	if err != nil {
+		t.Fatalf("PolicyFromEnv: %v", err)
+	}
+	if p.Direct || len(p.Allowed) != 0 {
+		t.Errorf("PolicyFromEnv = %+v, want no attestation and no allow-list", p)
+	}
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// AccessEvent is one access decision: a login, a booking or a door unlock,
+// allowed or denied.
+type AccessEvent struct {
+	ID           int64    `json:"id"`
+	CreatedAt    int64    `json:"created_at"`
+	Type         string   `json:"type"`
+	Outcome      string   `json:"outcome"`
+	Reason       string   `json:"reason,omitempty"`
+	UserID       int64    `json:"user_id,omitempty"`
+	Username     string   `json:"username,omitempty"`
+	DoorID       int64    `json:"door_id,omitempty"`
+	DoorName     string   `json:"door_name,omitempty"`
+	BookingID    int64    `json:"booking_id,omitempty"`
+	DistanceM    *float64 `json:"distance_m,omitempty"`
+	AccuracyM    *float64 `json:"accuracy_m,omitempty"`
+	IP           string   `json:"ip,omitempty"`
+	CredentialID string   `json:"credential_id,omitempty"`
+	Details      string   `json:"details,omitempty"`
+}
+
+// Distance is DistanceM in meters, or 0 when no location was checked.
+func (e AccessEvent) Distance() float64 {
+	if e.DistanceM == nil {
+		return 0
+	}
+	return *e.DistanceM
+}
+
+// Accuracy is AccuracyM in meters, or 0 when the client reported none.
+func (e AccessEvent) Accuracy() float64 {
+	if e.AccuracyM == nil {
+		return 0
+	}
+	return *e.AccuracyM
+}
+
+const (
+	EventLogin    = "login"
+	EventBooking  = "booking"
+	EventUnlock   = "unlock"
+	EventRecovery = "recovery"
+	EventApproval = "approval"
+	// EventGuestUnlock is a door opened with a guest link; UserID is the
+	// member who booked the room.
+	EventGuestUnlock = "guest_unlock"
+
+	OutcomeAllowed = "allowed"
+	OutcomeDenied  = "denied"
+	OutcomeError   = "error"
+)
+
+func nullInt(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+func (db *DB) RecordAccessEvent(e AccessEvent) error {
+	_, err := db.Exec(
+		`INSERT INTO access_events (created_at, event_type, outcome, reason, user_id, username, door_id, booking_id, distance_m, accuracy_m, ip, credential_id, details)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.CreatedAt, e.Type, e.Outcome, e.Reason, nullInt(e.UserID), e.Username, nullInt(e.DoorID), nullInt(e.BookingID),
+		e.DistanceM, e.AccuracyM, e.IP, e.CredentialID, e.Details,
+	)
+	return err
+}
+
+// AccessEventFilter narrows ListAccessEvents. Zero fields are ignored.
+type AccessEventFilter struct {
+	UserID  int64
+	DoorID  int64
+	Type    string
+	Outcome string
+	From    int64
+	To      int64
+	Limit   int
+}
+
+// ListAccessEvents returns matching events, newest first.
+func (db *DB) ListAccessEvents(f AccessEventFilter) ([]AccessEvent, error) {
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if f.UserID != 0 {
+		where = append(where, "e.user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.DoorID != 0 {
+		where = append(where, "e.door_id = ?")
+		args = append(args, f.DoorID)
+	}
+	if f.Type != "" {
+		where = append(where, "e.event_type = ?")
+		args = append(args, f.Type)
+	}
+	if f.Outcome != "" {
+		where = append(where, "e.outcome = ?")
+		args = append(args, f.Outcome)
+	}
+	if f.From != 0 {
+		where = append(where, "e.created_at >= ?")
+		args = append(args, f.From)
+	}
+	if f.To != 0 {
+		where = append(where, "e.created_at < ?")
+		args = append(args, f.To)
+	}
+
+	query := `SELECT e.id, e.created_at, e.event_type, e.outcome, COALESCE(e.reason, ''), COALESCE(e.user_id, 0),
+		 COALESCE(u.username, e.username, ''), COALESCE(e.door_id, 0), COALESCE(d.name, ''), COALESCE(e.booking_id, 0),
+		 e.distance_m, e.accuracy_m, COALESCE(e.ip, ''), COALESCE(e.credential_id, ''), COALESCE(e.details, '')
+		 FROM access_events e LEFT JOIN users u ON u.id = e.user_id LEFT JOIN doors d ON d.id = e.door_id
+		 WHERE ` + strings.Join(where, " AND ") + ` ORDER BY e.created_at DESC, e.id DESC`
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []AccessEvent
+	for rows.Next() {
+		var e AccessEvent
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Type, &e.Outcome, &e.Reason, &e.UserID, &e.Username, &e.DoorID, &e.DoorName,
+			&e.BookingID, &e.DistanceM, &e.AccuracyM, &e.IP, &e.CredentialID, &e.Details); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
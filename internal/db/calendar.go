@@ -0,0 +1,91 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Only a hash of calendar and display tokens is stored, like invite and
+// session tokens, so their URLs are shown once when they are created.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HasCalendarToken reports whether the user has created a calendar feed.
+func (db *DB) HasCalendarToken(userID int64) (bool, error) {
+	var hash sql.NullString
+	if err := db.QueryRow("SELECT calendar_token_hash FROM users WHERE id = ?", userID).Scan(&hash); err != nil {
+		return false, err
+	}
+	return hash.String != "", nil
+}
+
+// ResetCalendarToken replaces the user's feed secret, so subscriptions using
+// the old URL stop working, and returns the new one.
+func (db *DB) ResetCalendarToken(userID int64) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	if _, err := db.Exec("UPDATE users SET calendar_token_hash = ? WHERE id = ?", hashToken(token), userID); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetUserByCalendarToken returns the ID, display name and status of the
+// user owning a feed token.
+func (db *DB) GetUserByCalendarToken(token string) (int64, string, string, error) {
+	var id int64
+	var displayName, status string
+	err := db.QueryRow(
+		"SELECT id, display_name, status FROM users WHERE calendar_token_hash = ?",
+		hashToken(token),
+	).Scan(&id, &displayName, &status)
+	return id, displayName, status, err
+}
+
+// hashTokens moves tokens stored in plaintext by older versions to
+// calendar_token_hash, so existing feed URLs keep working.
+func (db *DB) hashTokens() error {
+	rows, err := db.Query("SELECT id, calendar_token FROM users WHERE calendar_token IS NOT NULL AND calendar_token != ''")
+	if err != nil {
+		return err
+	}
+	tokens := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var token string
+		if err := rows.Scan(&id, &token); err != nil {
+			rows.Close()
+			return err
+		}
+		tokens[id] = token
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, token := range tokens {
+		if _, err := db.Exec(
+			"UPDATE users SET calendar_token_hash = ?, calendar_token = NULL WHERE id = ?",
+			hashToken(token), id,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestCalendarTokenIsHashed(t *testing.T) {
+	database := newTestDB(t)
+	userID, err := database.CreateUser("alice", "Alice", "active", 0)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	token, err := database.ResetCalendarToken(userID)
+	if err != nil {
+		t.Fatalf("ResetCalendarToken: %v", err)
+	}
+	var stored string
+	if err := database.QueryRow("SELECT calendar_token_hash FROM users WHERE id = ?", userID).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored == token || stored != hashToken(token) {
+		t.Errorf("stored token %q is not the hash of %q", stored, token)
+	}
+
+	id, _, status, err := database.GetUserByCalendarToken(token)
+	if err != nil || id != userID || status != "active" {
+		t.Errorf("GetUserByCalendarToken = %d, %q, %v", id, status, err)
+	}
+	if _, _, _, err := database.GetUserByCalendarToken(stored); err != sql.ErrNoRows {
+		t.Errorf("lookup by the stored hash: err = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestPlaintextCalendarTokensAreMigrated(t *testing.T) {
+	database := newTestDB(t)
+	userID, err := database.CreateUser("alice", "Alice", "active", 0)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := database.Exec("UPDATE users SET calendar_token = 'legacy-token' WHERE id = ?", userID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	if id, _, _, err := database.GetUserByCalendarToken("legacy-token"); err != nil || id != userID {
+		t.Errorf("GetUserByCalendarToken after migration = %d, %v", id, err)
+	}
+	var plaintext sql.NullString
+	if err := database.QueryRow("SELECT calendar_token FROM users WHERE id = ?", userID).Scan(&plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if plaintext.Valid {
+		t.Errorf("plaintext token %q was kept", plaintext.String)
+	}
+}
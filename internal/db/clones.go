@@ -0,0 +1,135 @@
+package db
+
+import "encoding/base64"
+
+// Flags set on a passkey whose signature counter went backwards, which
+// suggests it was copied to another authenticator.
+const (
+	CloneFlagReregister = "reregister"
+	CloneFlagSuspended  = "suspended"
+	CloneFlagReview     = "review"
+)
+
+// CloneIncident is a login with a passkey whose signature counter did not
+// advance. CredentialID is base64url encoded, as in sessions and the audit
+// log. Incidents are kept when the passkey is deleted.
+type CloneIncident struct {
+	ID             int64  `json:"id"`
+	UserID         int64  `json:"user_id"`
+	Username       string `json:"username"`
+	CredentialID   string `json:"credential_id"`
+	CredentialName string `json:"credential_name"`
+	CredentialFlag string `json:"credential_flag"`
+	SignCount      int64  `json:"sign_count"`
+	Action         string `json:"action"`
+	IP             string `json:"ip"`
+	CreatedAt      int64  `json:"created_at"`
+	ResolvedAt     int64  `json:"resolved_at,omitempty"`
+	ResolvedByName string `json:"resolved_by_name,omitempty"`
+}
+
+// RecordCloneIncident stores an incident and, unless flag is empty, flags
+// the passkey in the same transaction.
+func (db *DB) RecordCloneIncident(inc CloneIncident, flag string) (int64, error) {
+	rawID, err := base64.RawURLEncoding.DecodeString(inc.CredentialID)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`INSERT INTO clone_incidents (user_id, credential_id, sign_count, action, ip, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		inc.UserID, rawID, inc.SignCount, inc.Action, inc.IP, inc.CreatedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if flag != "" {
+		if _, err := tx.Exec("UPDATE credentials SET clone_flag = ? WHERE credential_id = ?", flag, rawID); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// GetCredentialFlag returns the clone flag of a passkey by its base64url ID,
+// or an empty string if it is not flagged.
+func (db *DB) GetCredentialFlag(credentialID string) (string, error) {
+	rawID, err := base64.RawURLEncoding.DecodeString(credentialID)
+	if err != nil {
+		return "", err
+	}
+	var flag string
+	err = db.QueryRow("SELECT COALESCE(clone_flag, '') FROM credentials WHERE credential_id = ?", rawID).Scan(&flag)
+	return flag, err
+}
+
+// ListCloneIncidents returns incidents newest first, open ones before
+// resolved ones.
+func (db *DB) ListCloneIncidents() ([]CloneIncident, error) {
+	rows, err := db.Query(`
+		SELECT i.id, i.user_id, COALESCE(u.username, ''), i.credential_id, COALESCE(c.nickname, ''),
+		       COALESCE(c.clone_flag, ''), i.sign_count, i.action, COALESCE(i.ip, ''), i.created_at,
+		       COALESCE(i.resolved_at, 0), COALESCE(r.username, '')
+		FROM clone_incidents i
+		LEFT JOIN users u ON u.id = i.user_id
+		LEFT JOIN credentials c ON c.credential_id = i.credential_id
+		LEFT JOIN users r ON r.id = i.resolved_by
+		ORDER BY i.resolved_at IS NOT NULL, i.created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var incidents []CloneIncident
+	for rows.Next() {
+		var inc CloneIncident
+		var rawID []byte
+		if err := rows.Scan(&inc.ID, &inc.UserID, &inc.Username, &rawID, &inc.CredentialName,
+			&inc.CredentialFlag, &inc.SignCount, &inc.Action, &inc.IP, &inc.CreatedAt,
+			&inc.ResolvedAt, &inc.ResolvedByName); err != nil {
+			return nil, err
+		}
+		inc.CredentialID = base64.RawURLEncoding.EncodeToString(rawID)
+		incidents = append(incidents, inc)
+	}
+	return incidents, rows.Err()
+}
+
+// ResolveCloneIncident closes an incident and lifts the flag from its
+// passkey, if the passkey still exists. It returns the incident's user.
+func (db *DB) ResolveCloneIncident(id, resolvedBy, resolvedAt int64) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	var rawID []byte
+	err = tx.QueryRow("SELECT user_id, credential_id FROM clone_incidents WHERE id = ? AND resolved_at IS NULL", id).Scan(&userID, &rawID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Repeated logins with the same passkey are one problem, so they are
+	// resolved together.
+	if _, err := tx.Exec("UPDATE clone_incidents SET resolved_at = ?, resolved_by = ? WHERE credential_id = ? AND resolved_at IS NULL", resolvedAt, resolvedBy, rawID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE credentials SET clone_flag = NULL WHERE credential_id = ?", rawID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// ErrLastCredential is returned when deleting a user's only passkey, which
+// would lock them out of their account.
+var ErrLastCredential = errors.New("cannot delete the last passkey")
+
+// RenameCredential sets the nickname of one of the user's passkeys.
+func (db *DB) RenameCredential(userID, id int64, nickname string) error {
+	result, err := db.Exec(
+		"UPDATE credentials SET nickname = ? WHERE id = ? AND user_id = ?",
+		nickname, id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectRows(result)
+}
+
+// DeleteUserCredential removes one of the user's passkeys unless it is
+// their last one, and returns its base64url credential ID.
+func (db *DB) DeleteUserCredential(userID, id int64) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var credentialID []byte
+	err = tx.QueryRow(
+		"SELECT credential_id FROM credentials WHERE id = ? AND user_id = ?",
+		id, userID,
+	).Scan(&credentialID)
+	if err != nil {
+		return "", err
+	}
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM credentials WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return "", err
+	}
+	if count <= 1 {
+		return "", ErrLastCredential
+	}
+
+	if _, err := tx.Exec("DELETE FROM credentials WHERE id = ?", id); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(credentialID), nil
+}
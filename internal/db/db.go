@@ -1,11 +1,16 @@
 package db
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"embed"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 //go:embed schema.sql
@@ -15,8 +20,27 @@ type DB struct {
 	*sql.DB
 }
 
+var (
+	ErrBookingConflict = errors.New("user already has a booking during this time")
+	ErrRoomFull        = errors.New("room is fully booked during this time")
+	ErrUsernameTaken   = errors.New("username is already taken")
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type execQuerier interface {
+	querier
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 func InitDB(filepath string) (*DB, error) {
-	db, err := sql.Open("sqlite3", filepath)
+	// BEGIN IMMEDIATE takes the write lock up front, so a conflict check and
+	// the insert that follows it cannot interleave with another writer.
+	db, err := sql.Open("sqlite3", filepath+"?_txlock=immediate&_busy_timeout=5000")
 	if err != nil {
 		return nil, err
 	}
@@ -25,6 +49,10 @@ func InitDB(filepath string) (*DB, error) {
 		return nil, err
 	}
 
+	if err := dropLegacySessions(db); err != nil {
+		return nil, fmt.Errorf("migrate sessions table: %w", err)
+	}
+
 	schema, err := schemaSQL.ReadFile("schema.sql")
 	if err != nil {
 		return nil, err
@@ -34,16 +62,140 @@ func InitDB(filepath string) (*DB, error) {
 		return nil, err
 	}
 
+	d := &DB{db}
+	if err := d.migrate(); err != nil {
+		return nil, fmt.Errorf("migrate database: %w", err)
+	}
+
 	log.Println("Database initialized successfully")
 
-	return &DB{db}, nil
+	return d, nil
 }
 
-func (db *DB) CreateUser(username, displayName string, createdAt int64) (int64, error) {
-	result, err := db.Exec(
-		"INSERT INTO users (username, display_name, created_at) VALUES (?, ?, ?)",
-		username, displayName, createdAt,
+// migrate brings databases created by older versions of schema.sql up to
+// date. Every step must be safe to run on an already migrated database.
+func (db *DB) migrate() error {
+	columns := []struct{ table, column, definition string }{
+		{"bookings", "door_id", "INTEGER REFERENCES doors(id)"},
+		{"doors", "capacity", "INTEGER NOT NULL DEFAULT 1"},
+		{"bookings", "series_id", "INTEGER REFERENCES booking_series(id)"},
+		{"users", "calendar_token", "TEXT"},
+		{"users", "role", "TEXT NOT NULL DEFAULT 'member'"},
+		{"users", "status", "TEXT NOT NULL DEFAULT 'active'"},
+		{"credentials", "aaguid", "BLOB"},
+		{"credentials", "nickname", "TEXT"},
+		{"credentials", "last_used_at", "INTEGER"},
+		{"users", "user_handle", "BLOB"},
+		{"users", "invite_id", "INTEGER REFERENCES invites(id)"},
+		{"credentials", "attestation_format", "TEXT"},
+		{"credentials", "clone_flag", "TEXT"},
+		{"doors", "step_up", "INTEGER NOT NULL DEFAULT 0"},
+		{"doors", "step_up_grace_seconds", "INTEGER NOT NULL DEFAULT 0"},
+		{"doors", "presence", "TEXT NOT NULL DEFAULT 'gps'"},
+		{"doors", "geofence", "TEXT"},
+		{"doors", "max_accuracy_m", "REAL NOT NULL DEFAULT 0"},
+		{"access_events", "accuracy_m", "REAL"},
+		{"bookings", "recurrence_id", "INTEGER"},
+		{"users", "calendar_token_hash", "TEXT"},
+		{"doors", "display_token_hash", "TEXT"},
+	}
+	for _, c := range columns {
+		if err := db.addColumnIfMissing(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// Users registered before user handles existed have passkeys that carry
+	// their username as the handle, so that is what they keep.
+	if _, err := db.Exec("UPDATE users SET user_handle = CAST(username AS BLOB) WHERE user_handle IS NULL"); err != nil {
+		return err
+	}
+
+	if err := db.hashTokens(); err != nil {
+		return err
+	}
+
+	// An occurrence's recurrence ID is the start time the series gave it,
+	// which for one that was moved is the start before its first move.
+	if _, err := db.Exec(
+		`UPDATE bookings SET recurrence_id = COALESCE(
+		 (SELECT old_start_time FROM booking_changes WHERE booking_id = bookings.id AND action = 'reschedule' ORDER BY id LIMIT 1),
+		 start_time)
+		 WHERE series_id IS NOT NULL AND recurrence_id IS NULL`,
+	); err != nil {
+		return err
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_bookings_door_time ON bookings(door_id, start_time, end_time)",
+		"CREATE INDEX IF NOT EXISTS idx_bookings_series ON bookings(series_id)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_calendar_token ON users(calendar_token)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_calendar_token_hash ON users(calendar_token_hash)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_user_handle ON users(user_handle)",
+	}
+	for _, stmt := range indexes {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	log.Printf("Migrating database: adding %s.%s", table, column)
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// CreateUser adds a user with a random WebAuthn user handle. The handle is
+// what authenticators store, so it must never change or reveal the username.
+func (db *DB) CreateUser(username, displayName, status string, createdAt int64) (int64, error) {
+	handle, err := NewUserHandle()
+	if err != nil {
+		return 0, err
+	}
+	return insertUser(db, username, displayName, handle, "member", status, 0, createdAt)
+}
+
+// NewUserHandle returns a random WebAuthn user handle.
+func NewUserHandle() ([]byte, error) {
+	handle := make([]byte, 32)
+	if _, err := rand.Read(handle); err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
+
+func insertUser(q execQuerier, username, displayName string, handle []byte, role, status string, inviteID, createdAt int64) (int64, error) {
+	result, err := q.Exec(
+		"INSERT INTO users (username, display_name, user_handle, role, status, invite_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		username, displayName, handle, role, status, nullInt(inviteID), createdAt,
 	)
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return 0, ErrUsernameTaken
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -69,30 +221,76 @@ func (db *DB) GetUserByID(userID int64) (string, string, error) {
 	return username, displayName, err
 }
 
-func (db *DB) SaveCredential(userID int64, credentialID, publicKey []byte, backupEligible, backupState bool, createdAt int64) error {
-	_, err := db.Exec(
-		"INSERT INTO credentials (user_id, credential_id, public_key, backup_eligible, backup_state, created_at) VALUES (?, ?, ?, ?, ?, ?)",
-		userID, credentialID, publicKey, backupEligible, backupState, createdAt,
+func (db *DB) GetUserHandle(userID int64) ([]byte, error) {
+	var handle []byte
+	err := db.QueryRow("SELECT user_handle FROM users WHERE id = ?", userID).Scan(&handle)
+	return handle, err
+}
+
+func (db *DB) GetUserByHandle(handle []byte) (int64, string, string, error) {
+	var id int64
+	var username, displayName string
+	err := db.QueryRow(
+		"SELECT id, username, display_name FROM users WHERE user_handle = ?",
+		handle,
+	).Scan(&id, &username, &displayName)
+	return id, username, displayName, err
+}
+
+// UpdateUserProfile changes a user's username and display name. A username
+// that is already taken fails with ErrUsernameTaken.
+func (db *DB) UpdateUserProfile(userID int64, username, displayName string) error {
+	result, err := db.Exec(
+		"UPDATE users SET username = ?, display_name = ? WHERE id = ?",
+		username, displayName, userID,
+	)
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrUsernameTaken
+	}
+	if err != nil {
+		return err
+	}
+	return expectRows(result)
+}
+
+func (db *DB) SaveCredential(userID int64, credentialID, publicKey, aaguid []byte, attestationFormat, nickname string, backupEligible, backupState bool, createdAt int64) error {
+	return saveCredential(db, userID, credentialID, publicKey, aaguid, attestationFormat, nickname, backupEligible, backupState, createdAt)
+}
+
+func saveCredential(q execQuerier, userID int64, credentialID, publicKey, aaguid []byte, attestationFormat, nickname string, backupEligible, backupState bool, createdAt int64) error {
+	_, err := q.Exec(
+		"INSERT INTO credentials (user_id, credential_id, public_key, aaguid, attestation_format, nickname, backup_eligible, backup_state, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, credentialID, publicKey, aaguid, attestationFormat, nickname, backupEligible, backupState, createdAt,
 	)
 	return err
 }
 
-func (db *DB) GetCredential(credentialID []byte) (int64, []byte, int, bool, bool, error) {
-	var userID int64
-	var publicKey []byte
-	var signCount int
-	var backupEligible, backupState bool
+// Credential is a stored passkey as the WebAuthn library needs it.
+type Credential struct {
+	UserID            int64
+	PublicKey         []byte
+	SignCount         int
+	BackupEligible    bool
+	BackupState       bool
+	AAGUID            []byte
+	AttestationFormat string
+}
+
+func (db *DB) GetCredential(credentialID []byte) (Credential, error) {
+	var c Credential
 	err := db.QueryRow(
-		"SELECT user_id, public_key, sign_count, backup_eligible, backup_state FROM credentials WHERE credential_id = ?",
+		"SELECT user_id, public_key, sign_count, backup_eligible, backup_state, aaguid, COALESCE(attestation_format, 'none') FROM credentials WHERE credential_id = ?",
 		credentialID,
-	).Scan(&userID, &publicKey, &signCount, &backupEligible, &backupState)
-	return userID, publicKey, signCount, backupEligible, backupState, err
+	).Scan(&c.UserID, &c.PublicKey, &c.SignCount, &c.BackupEligible, &c.BackupState, &c.AAGUID, &c.AttestationFormat)
+	return c, err
 }
 
-func (db *DB) UpdateSignCount(credentialID []byte, signCount int) error {
+// UpdateSignCount stores the counter from a successful login, which is also
+// when the passkey was last used.
+func (db *DB) UpdateSignCount(credentialID []byte, signCount int, usedAt int64) error {
 	_, err := db.Exec(
-		"UPDATE credentials SET sign_count = ? WHERE credential_id = ?",
-		signCount, credentialID,
+		"UPDATE credentials SET sign_count = ?, last_used_at = ? WHERE credential_id = ?",
+		signCount, usedAt, credentialID,
 	)
 	return err
 }
@@ -118,21 +316,86 @@ func (db *DB) GetCredentialsByUserID(userID int64) ([][]byte, error) {
 	return credentials, nil
 }
 
-func (db *DB) CreateBooking(userID, startTime, endTime, createdAt int64) (int64, error) {
-	result, err := db.Exec(
-		"INSERT INTO bookings (user_id, start_time, end_time, created_at) VALUES (?, ?, ?, ?)",
-		userID, startTime, endTime, createdAt,
+// CreateBooking inserts a booking after checking, in the same transaction,
+// that the user has no overlapping booking and the room has capacity left.
+func (db *DB) CreateBooking(userID, doorID, startTime, endTime, createdAt int64) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := checkBookingConflict(tx, userID, doorID, startTime, endTime, 0); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO bookings (user_id, door_id, start_time, end_time, created_at) VALUES (?, ?, ?, ?, ?)",
+		userID, doorID, startTime, endTime, createdAt,
 	)
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+
+	bookingID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return bookingID, tx.Commit()
 }
 
 func (db *DB) GetUserBookings(userID int64) ([]map[string]interface{}, error) {
+	return db.queryBookings("b.user_id = ?", userID)
+}
+
+// BookingFilter narrows GetAllBookings. Zero fields are ignored; From and To
+// select bookings overlapping that window.
+type BookingFilter struct {
+	UserID int64
+	DoorID int64
+	Status string
+	From   int64
+	To     int64
+}
+
+// GetAllBookings returns the bookings of every user matching the filter,
+// newest first.
+func (db *DB) GetAllBookings(f BookingFilter) ([]map[string]interface{}, error) {
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if f.UserID != 0 {
+		where = append(where, "b.user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.DoorID != 0 {
+		where = append(where, "b.door_id = ?")
+		args = append(args, f.DoorID)
+	}
+	if f.Status != "" {
+		where = append(where, "b.status = ?")
+		args = append(args, f.Status)
+	}
+	if f.From != 0 {
+		where = append(where, "b.end_time > ?")
+		args = append(args, f.From)
+	}
+	if f.To != 0 {
+		where = append(where, "b.start_time < ?")
+		args = append(args, f.To)
+	}
+	return db.queryBookings(strings.Join(where, " AND "), args...)
+}
+
+func (db *DB) queryBookings(where string, args ...interface{}) ([]map[string]interface{}, error) {
 	rows, err := db.Query(
-		"SELECT id, start_time, end_time, status, created_at FROM bookings WHERE user_id = ? ORDER BY start_time DESC",
-		userID,
+		`SELECT b.id, b.user_id, COALESCE(u.username, ''), COALESCE(u.display_name, ''), b.door_id, b.series_id,
+		 COALESCE(d.name, ''), COALESCE(d.site, ''), b.start_time, b.end_time, b.status, b.created_at,
+		 COALESCE(c.action, ''), COALESCE(c.created_at, 0)
+		 FROM bookings b LEFT JOIN doors d ON d.id = b.door_id
+		 LEFT JOIN users u ON u.id = b.user_id
+		 LEFT JOIN booking_changes c ON c.id = (SELECT MAX(id) FROM booking_changes WHERE booking_id = b.id)
+		 WHERE `+where+` ORDER BY b.start_time DESC`,
+		args...,
 	)
 	if err != nil {
 		return nil, err
@@ -141,20 +404,30 @@ func (db *DB) GetUserBookings(userID int64) ([]map[string]interface{}, error) {
 
 	var bookings []map[string]interface{}
 	for rows.Next() {
-		var id, startTime, endTime, createdAt int64
-		var status string
-		if err := rows.Scan(&id, &startTime, &endTime, &status, &createdAt); err != nil {
+		var id, userID, startTime, endTime, createdAt, lastChangeAt int64
+		var doorID, seriesID sql.NullInt64
+		var username, displayName, doorName, site, status, lastChange string
+		if err := rows.Scan(&id, &userID, &username, &displayName, &doorID, &seriesID, &doorName, &site, &startTime, &endTime, &status, &createdAt, &lastChange, &lastChangeAt); err != nil {
 			return nil, err
 		}
 		bookings = append(bookings, map[string]interface{}{
-			"id":         id,
-			"start_time": startTime,
-			"end_time":   endTime,
-			"status":     status,
-			"created_at": createdAt,
+			"id":             id,
+			"user_id":        userID,
+			"username":       username,
+			"display_name":   displayName,
+			"door_id":        doorID.Int64,
+			"series_id":      seriesID.Int64,
+			"door_name":      doorName,
+			"site":           site,
+			"start_time":     startTime,
+			"end_time":       endTime,
+			"status":         status,
+			"created_at":     createdAt,
+			"last_change":    lastChange,
+			"last_change_at": lastChangeAt,
 		})
 	}
-	return bookings, nil
+	return bookings, rows.Err()
 }
 
 func (db *DB) GetActiveBooking(userID, currentTime int64) (map[string]interface{}, error) {
@@ -177,12 +450,237 @@ func (db *DB) GetActiveBooking(userID, currentTime int64) (map[string]interface{
 	}, nil
 }
 
-func (db *DB) CheckBookingConflict(userID, startTime, endTime int64) (bool, error) {
+// GetActiveBookingForDoor finds an active booking that grants access to the
+// door: a booking for the door itself or, for entrances, for any room on the
+// same site.
+func (db *DB) GetActiveBookingForDoor(userID int64, door Door, currentTime int64) (map[string]interface{}, error) {
+	var id, doorID, startTime, endTime int64
+	var status string
+	err := db.QueryRow(
+		`SELECT b.id, b.door_id, b.start_time, b.end_time, b.status FROM bookings b JOIN doors d ON d.id = b.door_id
+		 WHERE b.user_id = ? AND b.start_time <= ? AND b.end_time >= ? AND b.status = 'active'
+		 AND (b.door_id = ? OR (? AND d.site = ?))
+		 ORDER BY b.door_id = ? DESC LIMIT 1`,
+		userID, currentTime, currentTime, door.ID, door.Entrance, door.Site, door.ID,
+	).Scan(&id, &doorID, &startTime, &endTime, &status)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":         id,
+		"door_id":    doorID,
+		"start_time": startTime,
+		"end_time":   endTime,
+		"status":     status,
+	}, nil
+}
+
+// CheckBookingConflict reports ErrBookingConflict or ErrRoomFull when the
+// window cannot be booked. excludeBookingID skips a booking being moved.
+func (db *DB) CheckBookingConflict(userID, doorID, startTime, endTime, excludeBookingID int64) error {
+	return checkBookingConflict(db, userID, doorID, startTime, endTime, excludeBookingID)
+}
+
+func checkBookingConflict(q querier, userID, doorID, startTime, endTime, excludeBookingID int64) error {
 	var count int
+	if err := q.QueryRow(
+		"SELECT COUNT(*) FROM bookings WHERE user_id = ? AND id != ? AND status = 'active' AND start_time < ? AND end_time > ?",
+		userID, excludeBookingID, endTime, startTime,
+	).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrBookingConflict
+	}
+
+	var capacity int
+	if err := q.QueryRow("SELECT capacity FROM doors WHERE id = ?", doorID).Scan(&capacity); err != nil {
+		return err
+	}
+
+	rows, err := q.Query(
+		"SELECT start_time, end_time FROM bookings WHERE door_id = ? AND id != ? AND status = 'active' AND start_time < ? AND end_time > ?",
+		doorID, excludeBookingID, endTime, startTime,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var intervals [][2]int64
+	for rows.Next() {
+		var s, e int64
+		if err := rows.Scan(&s, &e); err != nil {
+			return err
+		}
+		intervals = append(intervals, [2]int64{s, e})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if peakOccupancy(intervals) >= capacity {
+		return ErrRoomFull
+	}
+	return nil
+}
+
+// peakOccupancy returns the highest number of intervals that overlap at any
+// single instant.
+func peakOccupancy(intervals [][2]int64) int {
+	type event struct {
+		at    int64
+		delta int
+	}
+	events := make([]event, 0, len(intervals)*2)
+	for _, iv := range intervals {
+		events = append(events, event{iv[0], 1}, event{iv[1], -1})
+	}
+	// an interval ending at t frees its slot for one starting at t
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at != events[j].at {
+			return events[i].at < events[j].at
+		}
+		return events[i].delta < events[j].delta
+	})
+
+	peak, current := 0, 0
+	for _, ev := range events {
+		current += ev.delta
+		if current > peak {
+			peak = current
+		}
+	}
+	return peak
+}
+
+func (db *DB) GetBooking(bookingID int64) (map[string]interface{}, error) {
+	var id, userID, startTime, endTime int64
+	var doorID, seriesID sql.NullInt64
+	var status string
 	err := db.QueryRow(
-		"SELECT COUNT(*) FROM bookings WHERE user_id = ? AND status = 'active' AND ((start_time < ? AND end_time > ?) OR (start_time < ? AND end_time > ?) OR (start_time >= ? AND end_time <= ?))",
-		userID, endTime, startTime, startTime, startTime, startTime, endTime,
-	).Scan(&count)
+		"SELECT id, user_id, door_id, series_id, start_time, end_time, status FROM bookings WHERE id = ?",
+		bookingID,
+	).Scan(&id, &userID, &doorID, &seriesID, &startTime, &endTime, &status)
+
+	if err != nil {
+		return nil, err
+	}
 
-	return count > 0, err
+	return map[string]interface{}{
+		"id":         id,
+		"user_id":    userID,
+		"door_id":    doorID.Int64,
+		"series_id":  seriesID.Int64,
+		"start_time": startTime,
+		"end_time":   endTime,
+		"status":     status,
+	}, nil
+}
+
+func (db *DB) CancelBooking(bookingID, changedBy, changedAt int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var startTime, endTime int64
+	var seriesID, recurrenceID sql.NullInt64
+	if err := tx.QueryRow(
+		"SELECT start_time, end_time, series_id, recurrence_id FROM bookings WHERE id = ? AND status = 'active'",
+		bookingID,
+	).Scan(&startTime, &endTime, &seriesID, &recurrenceID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE bookings SET status = 'cancelled' WHERE id = ?", bookingID); err != nil {
+		return err
+	}
+
+	// A cancelled occurrence becomes an EXDATE of its series, so editing the
+	// series later does not bring it back.
+	if seriesID.Valid && recurrenceID.Valid {
+		if err := addSeriesExdate(tx, seriesID.Int64, recurrenceID.Int64); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO booking_changes (booking_id, changed_by, action, old_start_time, old_end_time, created_at) VALUES (?, ?, 'cancel', ?, ?, ?)",
+		bookingID, changedBy, startTime, endTime, changedAt,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) RescheduleBooking(bookingID, changedBy, newStart, newEnd, changedAt int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID, doorID, startTime, endTime int64
+	if err := tx.QueryRow(
+		"SELECT user_id, door_id, start_time, end_time FROM bookings WHERE id = ? AND status = 'active'",
+		bookingID,
+	).Scan(&userID, &doorID, &startTime, &endTime); err != nil {
+		return err
+	}
+
+	if err := checkBookingConflict(tx, userID, doorID, newStart, newEnd, bookingID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE bookings SET start_time = ?, end_time = ? WHERE id = ?", newStart, newEnd, bookingID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO booking_changes (booking_id, changed_by, action, old_start_time, old_end_time, new_start_time, new_end_time, created_at) VALUES (?, ?, 'reschedule', ?, ?, ?, ?, ?)",
+		bookingID, changedBy, startTime, endTime, newStart, newEnd, changedAt,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) GetBookingChanges(bookingID int64) ([]map[string]interface{}, error) {
+	rows, err := db.Query(
+		`SELECT c.action, c.changed_by, u.display_name, c.old_start_time, c.old_end_time, c.new_start_time, c.new_end_time, c.created_at
+		 FROM booking_changes c JOIN users u ON u.id = c.changed_by
+		 WHERE c.booking_id = ? ORDER BY c.created_at`,
+		bookingID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []map[string]interface{}
+	for rows.Next() {
+		var action, changedByName string
+		var changedBy, createdAt int64
+		var oldStart, oldEnd, newStart, newEnd sql.NullInt64
+		if err := rows.Scan(&action, &changedBy, &changedByName, &oldStart, &oldEnd, &newStart, &newEnd, &createdAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, map[string]interface{}{
+			"action":          action,
+			"changed_by":      changedBy,
+			"changed_by_name": changedByName,
+			"old_start_time":  oldStart.Int64,
+			"old_end_time":    oldEnd.Int64,
+			"new_start_time":  newStart.Int64,
+			"new_end_time":    newEnd.Int64,
+			"created_at":      createdAt,
+		})
+	}
+	return changes, nil
 }
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+type Door struct {
+	ID             int64           `json:"id"`
+	Name           string          `json:"name"`
+	Site           string          `json:"site"`
+	Latitude       float64         `json:"latitude"`
+	Longitude      float64         `json:"longitude"`
+	RadiusM        float64         `json:"radius_m"`
+	Entrance       bool            `json:"entrance"`
+	Capacity       int             `json:"capacity"`
+	ActuatorConfig json.RawMessage `json:"actuator,omitempty"`
+	// StepUp requires a fresh passkey assertion for every unlock, or one
+	// within the last StepUpGraceSeconds for this door.
+	StepUp             bool `json:"step_up"`
+	StepUpGraceSeconds int  `json:"step_up_grace_seconds"`
+	// Presence is how the member shows they are at the door: "gps",
+	// "qr", "gps_or_qr" or "gps_and_qr" (see package presence).
+	Presence string `json:"presence"`
+	// Geofence is a GeoJSON Polygon or MultiPolygon that replaces the
+	// circle of RadiusM around the door.
+	Geofence json.RawMessage `json:"geofence,omitempty"`
+	// MaxAccuracyM rejects location fixes less accurate than this.
+	MaxAccuracyM float64 `json:"max_accuracy_m"`
+	CreatedAt    int64   `json:"created_at"`
+}
+
+const doorColumns = "id, name, site, latitude, longitude, radius_m, is_entrance, capacity, actuator_config, step_up, step_up_grace_seconds, presence, geofence, max_accuracy_m, created_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDoor(row rowScanner) (Door, error) {
+	var d Door
+	var actuatorConfig, geofence sql.NullString
+	err := row.Scan(&d.ID, &d.Name, &d.Site, &d.Latitude, &d.Longitude, &d.RadiusM, &d.Entrance, &d.Capacity, &actuatorConfig, &d.StepUp, &d.StepUpGraceSeconds, &d.Presence, &geofence, &d.MaxAccuracyM, &d.CreatedAt)
+	if actuatorConfig.Valid && actuatorConfig.String != "" {
+		d.ActuatorConfig = json.RawMessage(actuatorConfig.String)
+	}
+	if geofence.Valid && geofence.String != "" {
+		d.Geofence = json.RawMessage(geofence.String)
+	}
+	return d, err
+}
+
+func (db *DB) queryDoors(query string, args ...interface{}) ([]Door, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var doors []Door
+	for rows.Next() {
+		d, err := scanDoor(rows)
+		if err != nil {
+			return nil, err
+		}
+		doors = append(doors, d)
+	}
+	return doors, rows.Err()
+}
+
+func (db *DB) ListDoors() ([]Door, error) {
+	return db.queryDoors("SELECT " + doorColumns + " FROM doors ORDER BY site, is_entrance DESC, name")
+}
+
+func (db *DB) ListBookableDoors() ([]Door, error) {
+	return db.queryDoors("SELECT " + doorColumns + " FROM doors WHERE is_entrance = 0 ORDER BY site, name")
+}
+
+func (db *DB) GetDoor(doorID int64) (Door, error) {
+	return scanDoor(db.QueryRow("SELECT "+doorColumns+" FROM doors WHERE id = ?", doorID))
+}
+
+func (db *DB) UpsertDoor(d Door, createdAt int64) (int64, error) {
+	var actuatorConfig, geofence interface{}
+	if len(d.ActuatorConfig) > 0 {
+		actuatorConfig = string(d.ActuatorConfig)
+	}
+	if len(d.Geofence) > 0 {
+		geofence = string(d.Geofence)
+	}
+	if d.Capacity <= 0 {
+		d.Capacity = 1
+	}
+	if d.Presence == "" {
+		d.Presence = "gps"
+	}
+
+	_, err := db.Exec(
+		`INSERT INTO doors (name, site, latitude, longitude, radius_m, is_entrance, capacity, actuator_config, step_up, step_up_grace_seconds, presence, geofence, max_accuracy_m, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET site = excluded.site, latitude = excluded.latitude, longitude = excluded.longitude,
+		 radius_m = excluded.radius_m, is_entrance = excluded.is_entrance, capacity = excluded.capacity,
+		 actuator_config = excluded.actuator_config, step_up = excluded.step_up, step_up_grace_seconds = excluded.step_up_grace_seconds,
+		 presence = excluded.presence, geofence = excluded.geofence, max_accuracy_m = excluded.max_accuracy_m`,
+		d.Name, d.Site, d.Latitude, d.Longitude, d.RadiusM, d.Entrance, d.Capacity, actuatorConfig, d.StepUp, d.StepUpGraceSeconds, d.Presence, geofence, d.MaxAccuracyM, createdAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = db.QueryRow("SELECT id FROM doors WHERE name = ?", d.Name).Scan(&id)
+	return id, err
+}
+
+// EnsureDefaultDoor creates the given door when no door exists yet and
+// assigns bookings made before doors existed to the first door.
+func (db *DB) EnsureDefaultDoor(d Door, createdAt int64) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM doors").Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		if _, err := db.UpsertDoor(d, createdAt); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.Exec(
+		"UPDATE bookings SET door_id = (SELECT id FROM doors WHERE is_entrance = 0 ORDER BY id LIMIT 1) WHERE door_id IS NULL",
+	)
+	return err
+}
+
+// GetUnlockableDoors returns the doors the user's active bookings grant access
+// to: the booked rooms plus the entrances of the same sites.
+func (db *DB) GetUnlockableDoors(userID, currentTime int64) ([]Door, error) {
+	return db.queryDoors(
+		`SELECT `+doorColumns+` FROM doors WHERE id IN (
+			SELECT d.id FROM doors d JOIN doors booked ON (d.id = booked.id OR (d.is_entrance = 1 AND d.site = booked.site))
+			JOIN bookings b ON b.door_id = booked.id
+			WHERE b.user_id = ? AND b.start_time <= ? AND b.end_time >= ? AND b.status = 'active'
+		) ORDER BY is_entrance DESC, name`,
+		userID, currentTime, currentTime,
+	)
+}
+
+// ResetDisplayToken gives the door a new display link token, so a display
+// still using the old link stops showing codes, and returns it.
+func (db *DB) ResetDisplayToken(doorID int64) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	result, err := db.Exec("UPDATE doors SET display_token_hash = ? WHERE id = ?", hashToken(token), doorID)
+	if err != nil {
+		return "", err
+	}
+	return token, expectRows(result)
+}
+
+// GetDoorByDisplayToken returns the door if token is its current display
+// link token, or sql.ErrNoRows.
+func (db *DB) GetDoorByDisplayToken(doorID int64, token string) (Door, error) {
+	return scanDoor(db.QueryRow(
+		"SELECT "+doorColumns+" FROM doors WHERE id = ? AND display_token_hash = ?",
+		doorID, hashToken(token),
+	))
+}
+
+// DoorsWithDisplayToken returns the IDs of the doors that have a display
+// link.
+func (db *DB) DoorsWithDisplayToken() (map[int64]bool, error) {
+	rows, err := db.Query("SELECT id FROM doors WHERE display_token_hash IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestDisplayToken(t *testing.T) {
+	database := newTestDB(t)
+	const door = 1
+
+	if _, err := database.GetDoorByDisplayToken(door, ""); err != sql.ErrNoRows {
+		t.Errorf("door without a display link: err = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	first, err := database.ResetDisplayToken(door)
+	if err != nil {
+		t.Fatalf("ResetDisplayToken: %v", err)
+	}
+	if d, err := database.GetDoorByDisplayToken(door, first); err != nil || d.ID != door {
+		t.Errorf("GetDoorByDisplayToken = %d, %v", d.ID, err)
+	}
+	if _, err := database.GetDoorByDisplayToken(door+1, first); err != sql.ErrNoRows {
+		t.Errorf("token of another door: err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if ids, err := database.DoorsWithDisplayToken(); err != nil || !ids[door] {
+		t.Errorf("DoorsWithDisplayToken = %v, %v", ids, err)
+	}
+
+	second, err := database.ResetDisplayToken(door)
+	if err != nil {
+		t.Fatalf("ResetDisplayToken: %v", err)
+	}
+	if _, err := database.GetDoorByDisplayToken(door, first); err != sql.ErrNoRows {
+		t.Errorf("replaced token: err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if _, err := database.GetDoorByDisplayToken(door, second); err != nil {
+		t.Errorf("new token: %v", err)
+	}
+
+	if _, err := database.ResetDisplayToken(99); err != sql.ErrNoRows {
+		t.Errorf("unknown door: err = %v, want %v", err, sql.ErrNoRows)
+	}
+}
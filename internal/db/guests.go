@@ -0,0 +1,104 @@
+package db
+
+// GuestPass lets someone without an account open the doors of a booking
+// while it is running. The booking fields are read live, so rescheduling or
+// cancelling the booking also moves or ends the pass.
+type GuestPass struct {
+	ID            int64  `json:"id"`
+	BookingID     int64  `json:"booking_id"`
+	GuestName     string `json:"guest_name"`
+	CreatedBy     int64  `json:"created_by"`
+	CreatedAt     int64  `json:"created_at"`
+	RevokedAt     int64  `json:"revoked_at,omitempty"`
+	LastUsedAt    int64  `json:"last_used_at,omitempty"`
+	HostUserID    int64  `json:"host_user_id"`
+	HostName      string `json:"host_name"`
+	DoorID        int64  `json:"door_id"`
+	DoorName      string `json:"door_name"`
+	StartTime     int64  `json:"start_time"`
+	EndTime       int64  `json:"end_time"`
+	BookingStatus string `json:"booking_status"`
+}
+
+const guestPassQuery = `SELECT g.id, g.booking_id, g.guest_name, g.created_by, g.created_at,
+	COALESCE(g.revoked_at, 0), COALESCE(g.last_used_at, 0),
+	b.user_id, u.display_name, COALESCE(b.door_id, 0), COALESCE(d.name, ''), b.start_time, b.end_time, b.status
+	FROM guest_passes g
+	JOIN bookings b ON b.id = g.booking_id
+	JOIN users u ON u.id = b.user_id
+	LEFT JOIN doors d ON d.id = b.door_id`
+
+func scanGuestPass(row rowScanner) (GuestPass, error) {
+	var p GuestPass
+	err := row.Scan(&p.ID, &p.BookingID, &p.GuestName, &p.CreatedBy, &p.CreatedAt, &p.RevokedAt, &p.LastUsedAt,
+		&p.HostUserID, &p.HostName, &p.DoorID, &p.DoorName, &p.StartTime, &p.EndTime, &p.BookingStatus)
+	return p, err
+}
+
+func (db *DB) CreateGuestPass(bookingID int64, guestName string, createdBy, createdAt int64) (int64, error) {
+	result, err := db.Exec(
+		"INSERT INTO guest_passes (booking_id, guest_name, created_by, created_at) VALUES (?, ?, ?, ?)",
+		bookingID, guestName, createdBy, createdAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (db *DB) GetGuestPass(id int64) (GuestPass, error) {
+	return scanGuestPass(db.QueryRow(guestPassQuery+" WHERE g.id = ?", id))
+}
+
+func (db *DB) ListBookingGuestPasses(bookingID int64) ([]GuestPass, error) {
+	rows, err := db.Query(guestPassQuery+" WHERE g.booking_id = ? ORDER BY g.created_at", bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passes []GuestPass
+	for rows.Next() {
+		p, err := scanGuestPass(rows)
+		if err != nil {
+			return nil, err
+		}
+		passes = append(passes, p)
+	}
+	return passes, rows.Err()
+}
+
+func (db *DB) CountBookingGuestPasses(bookingID int64) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM guest_passes WHERE booking_id = ? AND revoked_at IS NULL", bookingID).Scan(&count)
+	return count, err
+}
+
+func (db *DB) RevokeGuestPass(bookingID, id, revokedAt int64) error {
+	result, err := db.Exec(
+		"UPDATE guest_passes SET revoked_at = ? WHERE id = ? AND booking_id = ? AND revoked_at IS NULL",
+		revokedAt, id, bookingID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectRows(result)
+}
+
+func (db *DB) TouchGuestPass(id, usedAt int64) error {
+	_, err := db.Exec("UPDATE guest_passes SET last_used_at = ? WHERE id = ?", usedAt, id)
+	return err
+}
+
+// GetBookingDoors returns the doors a booking opens: the booked room and the
+// entrances of its site.
+func (db *DB) GetBookingDoors(bookingID int64) ([]Door, error) {
+	return db.queryDoors(
+		`SELECT `+doorColumns+` FROM doors WHERE id IN (
+			SELECT d.id FROM doors d JOIN doors booked ON (d.id = booked.id OR (d.is_entrance = 1 AND d.site = booked.site))
+			JOIN bookings b ON b.door_id = booked.id
+			WHERE b.id = ?
+		) ORDER BY is_entrance DESC, name`,
+		bookingID,
+	)
+}
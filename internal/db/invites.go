@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var ErrInviteInvalid = errors.New("invite is invalid, expired or used up")
+
+// Invite lets someone register while registration is closed. The token
+// itself is only shown to the admin who created it; the table keeps its
+// SHA-256 hash.
+type Invite struct {
+	ID            int64  `json:"id"`
+	DisplayName   string `json:"display_name"`
+	Role          string `json:"role"`
+	MaxUses       int    `json:"max_uses"`
+	Uses          int    `json:"uses"`
+	ExpiresAt     int64  `json:"expires_at,omitempty"`
+	CreatedBy     int64  `json:"created_by"`
+	CreatedByName string `json:"created_by_name"`
+	CreatedAt     int64  `json:"created_at"`
+	RevokedAt     int64  `json:"revoked_at,omitempty"`
+}
+
+// Usable reports whether the invite can still be used to register.
+func (inv Invite) Usable(now int64) bool {
+	return inv.RevokedAt == 0 && inv.Uses < inv.MaxUses && (inv.ExpiresAt == 0 || inv.ExpiresAt > now)
+}
+
+func (inv Invite) Status(now int64) string {
+	switch {
+	case inv.RevokedAt != 0:
+		return "revoked"
+	case inv.Uses >= inv.MaxUses:
+		return "used"
+	case inv.ExpiresAt != 0 && inv.ExpiresAt <= now:
+		return "expired"
+	}
+	return "active"
+}
+
+func (db *DB) CreateInvite(inv Invite, tokenHash string) (int64, error) {
+	result, err := db.Exec(
+		`INSERT INTO invites (token_hash, display_name, role, max_uses, expires_at, created_by, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		tokenHash, inv.DisplayName, inv.Role, inv.MaxUses, nullInt(inv.ExpiresAt), inv.CreatedBy, inv.CreatedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+const inviteColumns = `i.id, COALESCE(i.display_name, ''), i.role, i.max_uses, i.uses,
+	COALESCE(i.expires_at, 0), i.created_by, COALESCE(u.username, ''), i.created_at, COALESCE(i.revoked_at, 0)`
+
+func scanInvite(row interface{ Scan(...interface{}) error }) (Invite, error) {
+	var inv Invite
+	err := row.Scan(&inv.ID, &inv.DisplayName, &inv.Role, &inv.MaxUses, &inv.Uses,
+		&inv.ExpiresAt, &inv.CreatedBy, &inv.CreatedByName, &inv.CreatedAt, &inv.RevokedAt)
+	return inv, err
+}
+
+func getInviteByToken(q querier, tokenHash string) (Invite, error) {
+	return scanInvite(q.QueryRow(
+		"SELECT "+inviteColumns+" FROM invites i LEFT JOIN users u ON u.id = i.created_by WHERE i.token_hash = ?",
+		tokenHash,
+	))
+}
+
+func (db *DB) GetInviteByToken(tokenHash string) (Invite, error) {
+	return getInviteByToken(db, tokenHash)
+}
+
+func (db *DB) ListInvites() ([]Invite, error) {
+	rows, err := db.Query(
+		"SELECT " + inviteColumns + " FROM invites i LEFT JOIN users u ON u.id = i.created_by ORDER BY i.created_at DESC",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []Invite
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+func (db *DB) RevokeInvite(id, revokedAt int64) error {
+	result, err := db.Exec(
+		"UPDATE invites SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		revokedAt, id,
+	)
+	if err != nil {
+		return err
+	}
+	return expectRows(result)
+}
+
+// ErrBootstrapUsed is returned when a bootstrap admin registers after an
+// admin already exists.
+var ErrBootstrapUsed = errors.New("an admin already exists")
+
+// NewUser is an account that is created once its first passkey has been
+// registered, so an abandoned registration leaves nothing behind.
+type NewUser struct {
+	Username    string
+	DisplayName string
+	Handle      []byte
+	Role        string
+	Status      string
+	// InviteHash is the hash of the invite the user registers with. One use
+	// of it is consumed, and its display name and role take precedence.
+	InviteHash string
+	// Bootstrap only lets the user register while no admin exists.
+	Bootstrap bool
+}
+
+// NewCredential is the first passkey of a NewUser.
+type NewCredential struct {
+	ID                []byte
+	PublicKey         []byte
+	AAGUID            []byte
+	AttestationFormat string
+	BackupEligible    bool
+	BackupState       bool
+}
+
+// RegisterUser checks and uses up the invite, creates the user and saves
+// their first passkey in one transaction.
+func (db *DB) RegisterUser(u NewUser, cred NewCredential, createdAt int64) (int64, Invite, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, Invite{}, err
+	}
+	defer tx.Rollback()
+
+	var inv Invite
+	if u.InviteHash != "" {
+		inv, err = getInviteByToken(tx, u.InviteHash)
+		if err == sql.ErrNoRows || (err == nil && !inv.Usable(createdAt)) {
+			return 0, Invite{}, ErrInviteInvalid
+		}
+		if err != nil {
+			return 0, Invite{}, err
+		}
+		if _, err := tx.Exec("UPDATE invites SET uses = uses + 1 WHERE id = ?", inv.ID); err != nil {
+			return 0, Invite{}, err
+		}
+		inv.Uses++
+
+		if inv.DisplayName != "" {
+			u.DisplayName = inv.DisplayName
+		}
+		u.Role = inv.Role
+		u.Status = "active"
+	}
+
+	if u.Bootstrap {
+		var admins int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'admin'").Scan(&admins); err != nil {
+			return 0, Invite{}, err
+		}
+		if admins > 0 {
+			return 0, Invite{}, ErrBootstrapUsed
+		}
+	}
+
+	userID, err := insertUser(tx, u.Username, u.DisplayName, u.Handle, u.Role, u.Status, inv.ID, createdAt)
+	if err != nil {
+		return 0, Invite{}, err
+	}
+	if err := saveCredential(tx, userID, cred.ID, cred.PublicKey, cred.AAGUID, cred.AttestationFormat, "", cred.BackupEligible, cred.BackupState, createdAt); err != nil {
+		return 0, Invite{}, err
+	}
+
+	return userID, inv, tx.Commit()
+}
@@ -0,0 +1,55 @@
+package db
+
+import "testing"
+
+func TestRegisterUserConsumesInvite(t *testing.T) {
+	database := newTestDB(t)
+	if _, err := database.CreateInvite(Invite{DisplayName: "Ann", Role: "staff", MaxUses: 1}, "hash"); err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+
+	newUser := func(username string) NewUser {
+		return NewUser{Username: username, DisplayName: username, Handle: []byte(username), Role: "member", InviteHash: "hash"}
+	}
+	cred := func(id string) NewCredential {
+		return NewCredential{ID: []byte(id), PublicKey: []byte("key")}
+	}
+
+	userID, inv, err := database.RegisterUser(newUser("ann"), cred("c1"), 1)
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	if inv.Uses != 1 {
+		t.Errorf("invite uses = %d, want 1", inv.Uses)
+	}
+	user, err := database.GetUser(userID)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if user["display_name"] != "Ann" || user["role"] != "staff" || user["status"] != "active" {
+		t.Errorf("user = %v, want the invite's name and role", user)
+	}
+	if creds, err := database.GetCredentialsByUserID(userID); err != nil || len(creds) != 1 {
+		t.Errorf("credentials = %d, %v, want 1", len(creds), err)
+	}
+
+	if _, _, err := database.RegisterUser(newUser("bob"), cred("c2"), 2); err != ErrInviteInvalid {
+		t.Errorf("second use of a single-use invite: err = %v, want %v", err, ErrInviteInvalid)
+	}
+	if _, _, err := database.GetUserByUsername("bob"); err == nil {
+		t.Error("user bob was created with a used-up invite")
+	}
+}
+
+func TestRegisterUserBootstrapOnlyWithoutAdmin(t *testing.T) {
+	database := newTestDB(t)
+	admin := NewUser{Username: "boss", DisplayName: "Boss", Handle: []byte("boss"), Role: "admin", Status: "active", Bootstrap: true}
+	if _, _, err := database.RegisterUser(admin, NewCredential{ID: []byte("c1"), PublicKey: []byte("key")}, 1); err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+
+	second := NewUser{Username: "boss2", DisplayName: "Boss", Handle: []byte("boss2"), Role: "admin", Status: "active", Bootstrap: true}
+	if _, _, err := database.RegisterUser(second, NewCredential{ID: []byte("c2"), PublicKey: []byte("key")}, 2); err != ErrBootstrapUsed {
+		t.Errorf("second bootstrap admin: err = %v, want %v", err, ErrBootstrapUsed)
+	}
+}
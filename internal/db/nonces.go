@@ -0,0 +1,28 @@
+package db
+
+// CreateUnlockNonce stores the hash of a new unlock nonce for the user and
+// clears out expired ones.
+func (db *DB) CreateUnlockNonce(nonceHash string, userID, createdAt, expiresAt int64) error {
+	if _, err := db.Exec("DELETE FROM unlock_nonces WHERE expires_at <= ?", createdAt); err != nil {
+		return err
+	}
+	_, err := db.Exec(
+		"INSERT INTO unlock_nonces (nonce_hash, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		nonceHash, userID, createdAt, expiresAt,
+	)
+	return err
+}
+
+// ConsumeUnlockNonce deletes the user's nonce, so it can only be used once.
+// It returns sql.ErrNoRows if the nonce is unknown, belongs to someone else
+// or has expired.
+func (db *DB) ConsumeUnlockNonce(nonceHash string, userID, now int64) error {
+	result, err := db.Exec(
+		"DELETE FROM unlock_nonces WHERE nonce_hash = ? AND user_id = ? AND expires_at > ?",
+		nonceHash, userID, now,
+	)
+	if err != nil {
+		return err
+	}
+	return expectRows(result)
+}
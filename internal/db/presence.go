@@ -0,0 +1,42 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrPresenceCodeUsed is returned when a door code is used a second time.
+var ErrPresenceCodeUsed = errors.New("presence code already used")
+
+// presenceCodeRetention is how long used door codes are remembered, in
+// seconds. It only has to outlast the codes themselves.
+const presenceCodeRetention = 3600
+
+// PresenceCodeUsed reports whether subject already opened the door with the
+// code of the given period.
+func (db *DB) PresenceCodeUsed(doorID int64, counter uint64, subject string) (bool, error) {
+	var n int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM presence_code_uses WHERE door_id = ? AND counter = ? AND subject = ?",
+		doorID, int64(counter), subject,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// UsePresenceCode records that subject used the door code of the given
+// period, and returns ErrPresenceCodeUsed if they already did. Old records
+// are cleared out.
+func (db *DB) UsePresenceCode(doorID int64, counter uint64, subject string, usedAt int64) error {
+	if _, err := db.Exec("DELETE FROM presence_code_uses WHERE used_at <= ?", usedAt-presenceCodeRetention); err != nil {
+		return err
+	}
+	_, err := db.Exec(
+		"INSERT INTO presence_code_uses (door_id, counter, subject, used_at) VALUES (?, ?, ?, ?)",
+		doorID, int64(counter), subject, usedAt,
+	)
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+		return ErrPresenceCodeUsed
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package db
+
+import "testing"
+
+func TestUsePresenceCode(t *testing.T) {
+	database := newTestDB(t)
+	const door, counter, now = 1, 60000000, 1800000000
+
+	if used, err := database.PresenceCodeUsed(door, counter, "user:1"); err != nil || used {
+		t.Fatalf("PresenceCodeUsed before use = %v, %v", used, err)
+	}
+	if err := database.UsePresenceCode(door, counter, "user:1", now); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if used, err := database.PresenceCodeUsed(door, counter, "user:1"); err != nil || !used {
+		t.Errorf("PresenceCodeUsed after use = %v, %v", used, err)
+	}
+	if err := database.UsePresenceCode(door, counter, "user:1", now+5); err != ErrPresenceCodeUsed {
+		t.Errorf("second use: err = %v, want %v", err, ErrPresenceCodeUsed)
+	}
+	if err := database.UsePresenceCode(door, counter, "guest:1", now+5); err != nil {
+		t.Errorf("use by someone else: %v", err)
+	}
+	if err := database.UsePresenceCode(door, counter+1, "user:1", now+30); err != nil {
+		t.Errorf("next code: %v", err)
+	}
+
+	if err := database.UsePresenceCode(door, counter+200, "user:2", now+presenceCodeRetention+30); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := database.QueryRow("SELECT COUNT(*) FROM presence_code_uses").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("%d uses remembered after the retention, want 1", n)
+	}
+}
@@ -0,0 +1,46 @@
+package db
+
+// ReplaceRecoveryCodes stores a new set of recovery code hashes for the
+// user, invalidating all earlier codes.
+func (db *DB) ReplaceRecoveryCodes(userID int64, hashes []string, createdAt int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)",
+			userID, hash, createdAt,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused code as used. It returns sql.ErrNoRows if
+// the user has no such unused code.
+func (db *DB) UseRecoveryCode(userID int64, hash string, usedAt int64) error {
+	result, err := db.Exec(
+		"UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		usedAt, userID, hash,
+	)
+	if err != nil {
+		return err
+	}
+	return expectRows(result)
+}
+
+func (db *DB) CountRecoveryCodes(userID int64) (int, error) {
+	var n int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL",
+		userID,
+	).Scan(&n)
+	return n, err
+}
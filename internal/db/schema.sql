@@ -2,6 +2,12 @@ CREATE TABLE IF NOT EXISTS users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     username TEXT UNIQUE NOT NULL,
     display_name TEXT NOT NULL,
+    user_handle BLOB,
+    role TEXT NOT NULL DEFAULT 'member',
+    status TEXT NOT NULL DEFAULT 'active',
+    calendar_token TEXT,
+    calendar_token_hash TEXT,
+    invite_id INTEGER REFERENCES invites(id),
     created_at INTEGER NOT NULL
 );
 
@@ -13,25 +19,190 @@ CREATE TABLE IF NOT EXISTS credentials (
     sign_count INTEGER DEFAULT 0,
     backup_eligible INTEGER DEFAULT 0,
     backup_state INTEGER DEFAULT 0,
+    aaguid BLOB,
+    attestation_format TEXT,
+    nickname TEXT,
+    clone_flag TEXT,
     created_at INTEGER NOT NULL,
+    last_used_at INTEGER,
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
 CREATE TABLE IF NOT EXISTS sessions (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT UNIQUE NOT NULL,
+    user_id INTEGER,
+    credential_id TEXT,
+    data TEXT NOT NULL,
+    user_agent TEXT,
+    ip TEXT,
+    created_at INTEGER NOT NULL,
+    last_seen_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions(expires_at);
+
+CREATE TABLE IF NOT EXISTS invites (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT UNIQUE NOT NULL,
+    display_name TEXT,
+    role TEXT NOT NULL DEFAULT 'member',
+    max_uses INTEGER NOT NULL DEFAULT 1,
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at INTEGER,
+    created_by INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    revoked_at INTEGER,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS guest_passes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    booking_id INTEGER NOT NULL,
+    guest_name TEXT NOT NULL,
+    created_by INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    revoked_at INTEGER,
+    last_used_at INTEGER,
+    FOREIGN KEY (booking_id) REFERENCES bookings(id),
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_guest_passes_booking ON guest_passes(booking_id);
+
+CREATE TABLE IF NOT EXISTS clone_incidents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    credential_id BLOB NOT NULL,
+    sign_count INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    ip TEXT,
+    created_at INTEGER NOT NULL,
+    resolved_at INTEGER,
+    resolved_by INTEGER,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (resolved_by) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_clone_incidents_credential ON clone_incidents(credential_id);
+
+CREATE TABLE IF NOT EXISTS unlock_nonces (
+    nonce_hash TEXT PRIMARY KEY,
     user_id INTEGER NOT NULL,
-    challenge BLOB NOT NULL,
     created_at INTEGER NOT NULL,
     expires_at INTEGER NOT NULL,
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
+CREATE INDEX IF NOT EXISTS idx_unlock_nonces_expiry ON unlock_nonces(expires_at);
+
+CREATE TABLE IF NOT EXISTS presence_code_uses (
+    door_id INTEGER NOT NULL,
+    counter INTEGER NOT NULL,
+    subject TEXT NOT NULL,
+    used_at INTEGER NOT NULL,
+    PRIMARY KEY (door_id, counter, subject),
+    FOREIGN KEY (door_id) REFERENCES doors(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_presence_code_uses_time ON presence_code_uses(used_at);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    used_at INTEGER,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id);
+
+CREATE TABLE IF NOT EXISTS doors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    site TEXT NOT NULL DEFAULT 'main',
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL,
+    radius_m REAL NOT NULL DEFAULT 50,
+    is_entrance INTEGER DEFAULT 0,
+    capacity INTEGER NOT NULL DEFAULT 1,
+    actuator_config TEXT,
+    step_up INTEGER NOT NULL DEFAULT 0,
+    step_up_grace_seconds INTEGER NOT NULL DEFAULT 0,
+    presence TEXT NOT NULL DEFAULT 'gps',
+    geofence TEXT,
+    max_accuracy_m REAL NOT NULL DEFAULT 0,
+    display_token_hash TEXT,
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS booking_series (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    door_id INTEGER NOT NULL,
+    rrule TEXT NOT NULL,
+    exdates TEXT,
+    start_time INTEGER NOT NULL,
+    duration INTEGER NOT NULL,
+    status TEXT DEFAULT 'active',
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (door_id) REFERENCES doors(id)
+);
+
 CREATE TABLE IF NOT EXISTS bookings (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL,
+    door_id INTEGER,
+    series_id INTEGER,
+    recurrence_id INTEGER,
     start_time INTEGER NOT NULL,
     end_time INTEGER NOT NULL,
     status TEXT DEFAULT 'active',
     created_at INTEGER NOT NULL,
-    FOREIGN KEY (user_id) REFERENCES users(id)
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (door_id) REFERENCES doors(id),
+    FOREIGN KEY (series_id) REFERENCES booking_series(id)
 );
+
+CREATE TABLE IF NOT EXISTS booking_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    booking_id INTEGER NOT NULL,
+    changed_by INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    old_start_time INTEGER,
+    old_end_time INTEGER,
+    new_start_time INTEGER,
+    new_end_time INTEGER,
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (booking_id) REFERENCES bookings(id),
+    FOREIGN KEY (changed_by) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS access_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at INTEGER NOT NULL,
+    event_type TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    reason TEXT,
+    user_id INTEGER,
+    username TEXT,
+    door_id INTEGER,
+    booking_id INTEGER,
+    distance_m REAL,
+    accuracy_m REAL,
+    ip TEXT,
+    credential_id TEXT,
+    details TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (door_id) REFERENCES doors(id),
+    FOREIGN KEY (booking_id) REFERENCES bookings(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_events_time ON access_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_access_events_user ON access_events(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_access_events_door ON access_events(door_id, created_at);
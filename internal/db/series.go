@@ -0,0 +1,269 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// OccurrenceError tells which occurrence of a series could not be booked.
+type OccurrenceError struct {
+	Start int64
+	Err   error
+}
+
+func (e *OccurrenceError) Error() string {
+	return fmt.Sprintf("occurrence starting at %d: %v", e.Start, e.Err)
+}
+
+func (e *OccurrenceError) Unwrap() error {
+	return e.Err
+}
+
+// CreateBookingSeries stores a recurring booking and one booking row per
+// occurrence. Every occurrence is conflict checked in the same transaction;
+// if any of them fails nothing is stored.
+func (db *DB) CreateBookingSeries(userID, doorID int64, rule, exdates string, startTime, duration int64, occurrences []int64, createdAt int64) (int64, []int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO booking_series (user_id, door_id, rrule, exdates, start_time, duration, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, doorID, rule, exdates, startTime, duration, createdAt,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+	seriesID, err := result.LastInsertId()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	bookingIDs, err := insertOccurrences(tx, userID, doorID, seriesID, duration, occurrences, createdAt)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return seriesID, bookingIDs, tx.Commit()
+}
+
+func insertOccurrences(tx execQuerier, userID, doorID, seriesID, duration int64, occurrences []int64, createdAt int64) ([]int64, error) {
+	bookingIDs := make([]int64, 0, len(occurrences))
+	for _, start := range occurrences {
+		end := start + duration
+		if err := checkBookingConflict(tx, userID, doorID, start, end, 0); err != nil {
+			return nil, &OccurrenceError{Start: start, Err: err}
+		}
+
+		result, err := tx.Exec(
+			"INSERT INTO bookings (user_id, door_id, series_id, recurrence_id, start_time, end_time, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			userID, doorID, seriesID, start, start, end, createdAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		bookingIDs = append(bookingIDs, id)
+	}
+	return bookingIDs, nil
+}
+
+func (db *DB) GetBookingSeries(seriesID int64) (map[string]interface{}, error) {
+	var id, userID, doorID, startTime, duration, createdAt int64
+	var rule, exdates, status string
+	err := db.QueryRow(
+		"SELECT id, user_id, door_id, rrule, COALESCE(exdates, ''), start_time, duration, status, created_at FROM booking_series WHERE id = ?",
+		seriesID,
+	).Scan(&id, &userID, &doorID, &rule, &exdates, &startTime, &duration, &status, &createdAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":         id,
+		"user_id":    userID,
+		"door_id":    doorID,
+		"rrule":      rule,
+		"exdates":    exdates,
+		"start_time": startTime,
+		"duration":   duration,
+		"status":     status,
+		"created_at": createdAt,
+	}, nil
+}
+
+// addSeriesExdate adds an occurrence's recurrence ID to the EXDATEs of its
+// series.
+func addSeriesExdate(tx execQuerier, seriesID, recurrenceID int64) error {
+	_, err := tx.Exec(
+		`UPDATE booking_series SET exdates = CASE WHEN COALESCE(exdates, '') = '' THEN ? ELSE exdates || ',' || ? END
+		 WHERE id = ?`,
+		strconv.FormatInt(recurrenceID, 10), strconv.FormatInt(recurrenceID, 10), seriesID,
+	)
+	return err
+}
+
+// movedOccurrences returns the recurrence IDs of active occurrences that
+// were moved away from the time the series gave them. remap points each of
+// them at the time the updated rule gives the same occurrence; rows are
+// updated by ID so that a mapping onto another occurrence's old time does
+// not move that occurrence as well.
+func movedOccurrences(tx execQuerier, seriesID int64, remap map[int64]int64) (map[int64]bool, error) {
+	rows, err := tx.Query(
+		"SELECT id, recurrence_id FROM bookings WHERE series_id = ? AND status = 'active' AND recurrence_id IS NOT NULL AND start_time != recurrence_id",
+		seriesID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	moved := make(map[int64]bool)
+	updates := make(map[int64]int64)
+	for rows.Next() {
+		var id, recurrenceID int64
+		if err := rows.Scan(&id, &recurrenceID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if to, ok := remap[recurrenceID]; ok && to != recurrenceID {
+			updates[id] = to
+			recurrenceID = to
+		}
+		moved[recurrenceID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for id, recurrenceID := range updates {
+		if _, err := tx.Exec("UPDATE bookings SET recurrence_id = ? WHERE id = ?", recurrenceID, id); err != nil {
+			return nil, err
+		}
+	}
+	return moved, nil
+}
+
+// cancelSeriesOccurrences cancels the active occurrences of a series that
+// start (or, with ongoing, end) after now and records each cancellation.
+// With keepMoved, occurrences that were moved on their own are left alone.
+func cancelSeriesOccurrences(tx execQuerier, seriesID, changedBy, now int64, ongoing, keepMoved bool) error {
+	column := "start_time"
+	if ongoing {
+		column = "end_time"
+	}
+	where := "series_id = ? AND status = 'active' AND " + column + " > ?"
+	if keepMoved {
+		where += " AND (recurrence_id IS NULL OR start_time = recurrence_id)"
+	}
+
+	rows, err := tx.Query("SELECT id, start_time, end_time FROM bookings WHERE "+where, seriesID, now)
+	if err != nil {
+		return err
+	}
+
+	type occurrence struct{ id, start, end int64 }
+	var occurrences []occurrence
+	for rows.Next() {
+		var o occurrence
+		if err := rows.Scan(&o.id, &o.start, &o.end); err != nil {
+			rows.Close()
+			return err
+		}
+		occurrences = append(occurrences, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range occurrences {
+		if _, err := tx.Exec("UPDATE bookings SET status = 'cancelled' WHERE id = ?", o.id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO booking_changes (booking_id, changed_by, action, old_start_time, old_end_time, created_at) VALUES (?, ?, 'cancel', ?, ?, ?)",
+			o.id, changedBy, o.start, o.end, now,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelBookingSeries cancels every occurrence that has not ended yet and
+// marks the series itself as cancelled.
+func (db *DB) CancelBookingSeries(seriesID, changedBy, now int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := cancelSeriesOccurrences(tx, seriesID, changedBy, now, true, false); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE booking_series SET status = 'cancelled' WHERE id = ?", seriesID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RescheduleBookingSeries replaces the occurrences that have not started yet
+// with a new set generated from an updated rule. Occurrences in the past or
+// in progress are left untouched, and so are occurrences that were moved on
+// their own: like a RECURRENCE-ID override they replace the occurrence the
+// rule generates for their original time. Cancelled occurrences are kept out
+// by the series' EXDATEs. remap maps the old rule's occurrence times to the
+// new rule's, so overrides follow their occurrence when the series moves;
+// exdates must already use the new times.
+func (db *DB) RescheduleBookingSeries(seriesID, changedBy int64, rule, exdates string, startTime, duration int64, occurrences []int64, remap map[int64]int64, now int64) ([]int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userID, doorID int64
+	if err := tx.QueryRow(
+		"SELECT user_id, door_id FROM booking_series WHERE id = ? AND status = 'active'",
+		seriesID,
+	).Scan(&userID, &doorID); err != nil {
+		return nil, err
+	}
+
+	if err := cancelSeriesOccurrences(tx, seriesID, changedBy, now, false, true); err != nil {
+		return nil, err
+	}
+	moved, err := movedOccurrences(tx, seriesID, remap)
+	if err != nil {
+		return nil, err
+	}
+
+	generated := make([]int64, 0, len(occurrences))
+	for _, start := range occurrences {
+		if !moved[start] {
+			generated = append(generated, start)
+		}
+	}
+
+	bookingIDs, err := insertOccurrences(tx, userID, doorID, seriesID, duration, generated, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE booking_series SET rrule = ?, exdates = ?, start_time = ?, duration = ? WHERE id = ?",
+		rule, exdates, startTime, duration, seriesID,
+	); err != nil {
+		return nil, err
+	}
+
+	return bookingIDs, tx.Commit()
+}
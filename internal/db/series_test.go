@@ -0,0 +1,143 @@
+package db
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	database, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.EnsureDefaultDoor(Door{Name: "Studio", Site: "main", RadiusM: 50}, 0); err != nil {
+		t.Fatalf("EnsureDefaultDoor: %v", err)
+	}
+	return database
+}
+
+func TestRescheduleSeriesKeepsChangedOccurrences(t *testing.T) {
+	database := newTestDB(t)
+	userID, err := database.CreateUser("alice", "Alice", "active", 0)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	const day, hour = 86400, 3600
+	start := int64(10 * day)
+	occurrences := []int64{start, start + day, start + 2*day, start + 3*day}
+	seriesID, ids, err := database.CreateBookingSeries(userID, 1, "FREQ=DAILY;COUNT=4", "", start, hour, occurrences, 0)
+	if err != nil {
+		t.Fatalf("CreateBookingSeries: %v", err)
+	}
+
+	if err := database.CancelBooking(ids[1], userID, 1); err != nil {
+		t.Fatalf("CancelBooking: %v", err)
+	}
+	moved := start + 2*day + 2*hour
+	if err := database.RescheduleBooking(ids[2], userID, moved, moved+hour, 1); err != nil {
+		t.Fatalf("RescheduleBooking: %v", err)
+	}
+
+	series, err := database.GetBookingSeries(seriesID)
+	if err != nil {
+		t.Fatalf("GetBookingSeries: %v", err)
+	}
+	if got, want := series["exdates"], strconv.FormatInt(start+day, 10); got != want {
+		t.Errorf("exdates = %q, want %q", got, want)
+	}
+
+	// The handler expands the new rule without the EXDATE, so the moved
+	// occurrence's original time is the only one it still generates.
+	regenerated := []int64{start, start + 2*day, start + 3*day, start + 4*day}
+	if _, err := database.RescheduleBookingSeries(seriesID, userID, "FREQ=DAILY;COUNT=5", strconv.FormatInt(start+day, 10), start, hour, regenerated, nil, 2); err != nil {
+		t.Fatalf("RescheduleBookingSeries: %v", err)
+	}
+
+	checkActiveOccurrences(t, database, userID, map[int64]int64{start: 0, moved: ids[2], start + 3*day: 0, start + 4*day: 0})
+}
+
+// checkActiveOccurrences compares a user's active bookings, keyed by start
+// time, with want. A zero booking ID in want matches any booking.
+func checkActiveOccurrences(t *testing.T, database *DB, userID int64, want map[int64]int64) {
+	t.Helper()
+	bookings, err := database.GetUserBookings(userID)
+	if err != nil {
+		t.Fatalf("GetUserBookings: %v", err)
+	}
+	active := make(map[int64]int64)
+	for _, b := range bookings {
+		if b["status"] == "active" {
+			active[b["start_time"].(int64)] = b["id"].(int64)
+		}
+	}
+	if len(active) != len(want) {
+		t.Fatalf("active occurrences = %v, want starts %v", active, want)
+	}
+	for s, id := range want {
+		got, ok := active[s]
+		if !ok {
+			t.Errorf("no active occurrence at %d", s)
+			continue
+		}
+		if id != 0 && got != id {
+			t.Errorf("occurrence at %d is booking %d, want the moved booking %d", s, got, id)
+		}
+	}
+}
+
+func TestRescheduleSeriesToNewTimeKeepsExceptions(t *testing.T) {
+	database := newTestDB(t)
+	userID, err := database.CreateUser("alice", "Alice", "active", 0)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	const day, hour = 86400, 3600
+	start := int64(10 * day)
+	occurrences := []int64{start, start + day, start + 2*day, start + 3*day}
+	seriesID, ids, err := database.CreateBookingSeries(userID, 1, "FREQ=DAILY;COUNT=4", "", start, hour, occurrences, 0)
+	if err != nil {
+		t.Fatalf("CreateBookingSeries: %v", err)
+	}
+
+	if err := database.CancelBooking(ids[1], userID, 1); err != nil {
+		t.Fatalf("CancelBooking: %v", err)
+	}
+	moved := start + 2*day + 2*hour
+	if err := database.RescheduleBooking(ids[2], userID, moved, moved+hour, 1); err != nil {
+		t.Fatalf("RescheduleBooking: %v", err)
+	}
+
+	// shift moves the whole series later by offset, mapping each occurrence
+	// to the new one the way the handler does with recurrence.Remap.
+	shift := func(from, offset int64) map[int64]int64 {
+		remap := make(map[int64]int64)
+		for i := int64(0); i < 4; i++ {
+			remap[from+i*day] = from + i*day + offset
+		}
+		return remap
+	}
+
+	// Moving the series an hour later: the cancelled occurrence's EXDATE
+	// is remapped by the handler, so the rule no longer generates it, and
+	// the moved occurrence must not be booked again at its new slot.
+	regenerated := []int64{start + hour, start + 2*day + hour, start + 3*day + hour}
+	exdates := strconv.FormatInt(start+day+hour, 10)
+	if _, err := database.RescheduleBookingSeries(seriesID, userID, "FREQ=DAILY;COUNT=4", exdates, start+hour, hour, regenerated, shift(start, hour), 2); err != nil {
+		t.Fatalf("RescheduleBookingSeries: %v", err)
+	}
+	checkActiveOccurrences(t, database, userID, map[int64]int64{start + hour: 0, moved: ids[2], start + 3*day + hour: 0})
+
+	// Another hour later, the new slot of the moved occurrence is the time
+	// it was moved to. It still replaces the generated occurrence.
+	regenerated = []int64{start + 2*hour, start + 2*day + 2*hour, start + 3*day + 2*hour}
+	exdates = strconv.FormatInt(start+day+2*hour, 10)
+	if _, err := database.RescheduleBookingSeries(seriesID, userID, "FREQ=DAILY;COUNT=4", exdates, start+2*hour, hour, regenerated, shift(start+hour, hour), 2); err != nil {
+		t.Fatalf("RescheduleBookingSeries: %v", err)
+	}
+	checkActiveOccurrences(t, database, userID, map[int64]int64{start + 2*hour: 0, moved: ids[2], start + 3*day + 2*hour: 0})
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// Session is a server-side login session. The token itself only lives in
+// the user's cookie; the table keeps its SHA-256 hash.
+type Session struct {
+	ID           int64  `json:"id"`
+	TokenHash    string `json:"-"`
+	UserID       int64  `json:"user_id,omitempty"`
+	CredentialID string `json:"credential_id,omitempty"`
+	UserAgent    string `json:"user_agent"`
+	IP           string `json:"ip"`
+	CreatedAt    int64  `json:"created_at"`
+	LastSeenAt   int64  `json:"last_seen_at"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// dropLegacySessions removes the sessions table from older schemas, which
+// was never written to, so that schema.sql can create the current one.
+func dropLegacySessions(conn *sql.DB) error {
+	rows, err := conn.Query("PRAGMA table_info(sessions)")
+	if err != nil {
+		return err
+	}
+	var columns int
+	legacy := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		columns++
+		if name == "challenge" {
+			legacy = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if columns > 0 && legacy {
+		_, err = conn.Exec("DROP TABLE sessions")
+	}
+	return err
+}
+
+// LoadSession returns the encoded values of an unexpired session.
+func (db *DB) LoadSession(tokenHash string, now int64) (string, int64, error) {
+	var data string
+	var lastSeen int64
+	err := db.QueryRow(
+		"SELECT data, last_seen_at FROM sessions WHERE token_hash = ? AND expires_at > ?",
+		tokenHash, now,
+	).Scan(&data, &lastSeen)
+	return data, lastSeen, err
+}
+
+func (db *DB) SaveSession(s Session, data string) error {
+	_, err := db.Exec(
+		`INSERT INTO sessions (token_hash, user_id, credential_id, data, user_agent, ip, created_at, last_seen_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(token_hash) DO UPDATE SET
+		   user_id = excluded.user_id,
+		   credential_id = excluded.credential_id,
+		   data = excluded.data,
+		   user_agent = excluded.user_agent,
+		   ip = excluded.ip,
+		   last_seen_at = excluded.last_seen_at,
+		   expires_at = excluded.expires_at`,
+		s.TokenHash, nullInt(s.UserID), s.CredentialID, data, s.UserAgent, s.IP, s.CreatedAt, s.LastSeenAt, s.ExpiresAt,
+	)
+	return err
+}
+
+func (db *DB) TouchSession(tokenHash, ip string, now int64) error {
+	_, err := db.Exec("UPDATE sessions SET last_seen_at = ?, ip = ? WHERE token_hash = ?", now, ip, tokenHash)
+	return err
+}
+
+func (db *DB) DeleteSession(tokenHash string) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE token_hash = ?", tokenHash)
+	return err
+}
+
+func (db *DB) DeleteExpiredSessions(now int64) (int64, error) {
+	result, err := db.Exec("DELETE FROM sessions WHERE expires_at <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListUserSessions returns the user's signed-in sessions, most recently
+// used first.
+func (db *DB) ListUserSessions(userID, now int64) ([]Session, error) {
+	rows, err := db.Query(
+		`SELECT id, token_hash, COALESCE(user_id, 0), COALESCE(credential_id, ''), COALESCE(user_agent, ''), COALESCE(ip, ''),
+		 created_at, last_seen_at, expires_at
+		 FROM sessions WHERE user_id = ? AND expires_at > ? ORDER BY last_seen_at DESC`,
+		userID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.TokenHash, &s.UserID, &s.CredentialID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (db *DB) GetSessionOwner(id int64) (int64, error) {
+	var userID sql.NullInt64
+	err := db.QueryRow("SELECT user_id FROM sessions WHERE id = ?", id).Scan(&userID)
+	return userID.Int64, err
+}
+
+// RevokeSession deletes one session by its row ID and returns the user it
+// belonged to.
+func (db *DB) RevokeSession(id int64) (int64, error) {
+	var userID sql.NullInt64
+	if err := db.QueryRow("SELECT user_id FROM sessions WHERE id = ?", id).Scan(&userID); err != nil {
+		return 0, err
+	}
+	result, err := db.Exec("DELETE FROM sessions WHERE id = ?", id)
+	if err != nil {
+		return 0, err
+	}
+	return userID.Int64, expectRows(result)
+}
+
+// RevokeUserSessions signs the user out everywhere except, optionally, the
+// session with exceptTokenHash.
+func (db *DB) RevokeUserSessions(userID int64, exceptTokenHash string) (int64, error) {
+	result, err := db.Exec("DELETE FROM sessions WHERE user_id = ? AND token_hash != ?", userID, exceptTokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RevokeCredentialSessions signs out every session opened with the passkey.
+func (db *DB) RevokeCredentialSessions(credentialID string) (int64, error) {
+	if credentialID == "" {
+		return 0, nil
+	}
+	result, err := db.Exec("DELETE FROM sessions WHERE credential_id = ?", credentialID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"database/sql"
+	"door-control/internal/aaguid"
+	"encoding/base64"
+	"strings"
+)
+
+func (db *DB) GetUserRole(userID int64) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role)
+	return role, err
+}
+
+func (db *DB) GetUserStatus(userID int64) (string, error) {
+	var status string
+	err := db.QueryRow("SELECT status FROM users WHERE id = ?", userID).Scan(&status)
+	return status, err
+}
+
+func (db *DB) SetUserStatus(userID int64, status string) error {
+	result, err := db.Exec("UPDATE users SET status = ? WHERE id = ?", status, userID)
+	if err != nil {
+		return err
+	}
+	return expectRows(result)
+}
+
+func (db *DB) SetUserRole(userID int64, role string) error {
+	result, err := db.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID)
+	if err != nil {
+		return err
+	}
+	return expectRows(result)
+}
+
+// expectRows turns an update or delete that matched nothing into
+// sql.ErrNoRows.
+func expectRows(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PromoteUsers gives the named users the role, skipping names that are not
+// registered yet. It returns how many users were changed.
+func (db *DB) PromoteUsers(usernames []string, role string) (int64, error) {
+	if len(usernames) == 0 {
+		return 0, nil
+	}
+	args := []interface{}{role, role}
+	for _, name := range usernames {
+		args = append(args, name)
+	}
+	result, err := db.Exec(
+		"UPDATE users SET role = ? WHERE role != ? AND username IN (?"+strings.Repeat(", ?", len(usernames)-1)+")",
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (db *DB) CountUsersWithRole(role string) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE role = ?", role).Scan(&n)
+	return n, err
+}
+
+func (db *DB) ListUsers() ([]map[string]interface{}, error) {
+	return db.queryUsers("1 = 1")
+}
+
+// ListPendingUsers returns the users waiting for approval and the ones that
+// were rejected.
+func (db *DB) ListPendingUsers() ([]map[string]interface{}, error) {
+	return db.queryUsers("u.status IN ('pending', 'rejected')")
+}
+
+// ReviewUser approves ("active") or rejects ("rejected") a user waiting for
+// approval. Rejected users can still be approved later.
+func (db *DB) ReviewUser(userID int64, status string) error {
+	result, err := db.Exec(
+		"UPDATE users SET status = ? WHERE id = ? AND status IN ('pending', 'rejected') AND status != ?",
+		status, userID, status,
+	)
+	if err != nil {
+		return err
+	}
+	return expectRows(result)
+}
+
+func (db *DB) GetUser(userID int64) (map[string]interface{}, error) {
+	users, err := db.queryUsers("u.id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return users[0], nil
+}
+
+func (db *DB) queryUsers(where string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Query(
+		`SELECT u.id, u.username, u.display_name, u.role, u.status, u.created_at,
+		 (SELECT COUNT(*) FROM credentials c WHERE c.user_id = u.id),
+		 (SELECT COUNT(*) FROM bookings b WHERE b.user_id = u.id AND b.status = 'active')
+		 FROM users u WHERE `+where+` ORDER BY u.username`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []map[string]interface{}
+	for rows.Next() {
+		var id, createdAt, credentials, bookings int64
+		var username, displayName, role, status string
+		if err := rows.Scan(&id, &username, &displayName, &role, &status, &createdAt, &credentials, &bookings); err != nil {
+			return nil, err
+		}
+		users = append(users, map[string]interface{}{
+			"id":              id,
+			"username":        username,
+			"display_name":    displayName,
+			"role":            role,
+			"status":          status,
+			"created_at":      createdAt,
+			"credentials":     credentials,
+			"active_bookings": bookings,
+		})
+	}
+	return users, rows.Err()
+}
+
+func (db *DB) ListUserCredentials(userID int64) ([]map[string]interface{}, error) {
+	rows, err := db.Query(
+		`SELECT id, credential_id, aaguid, COALESCE(attestation_format, 'none'), COALESCE(nickname, ''), COALESCE(clone_flag, ''), sign_count, backup_eligible, backup_state, created_at, last_used_at
+		 FROM credentials WHERE user_id = ? ORDER BY created_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []map[string]interface{}
+	for rows.Next() {
+		var id, signCount, createdAt int64
+		var credentialID, rawAAGUID []byte
+		var attestationFormat, nickname, cloneFlag string
+		var backupEligible, backupState bool
+		var lastUsedAt sql.NullInt64
+		if err := rows.Scan(&id, &credentialID, &rawAAGUID, &attestationFormat, &nickname, &cloneFlag, &signCount, &backupEligible, &backupState, &createdAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		authenticator := aaguid.String(rawAAGUID)
+		credentials = append(credentials, map[string]interface{}{
+			"id":              id,
+			"credential_id":   base64.RawURLEncoding.EncodeToString(credentialID),
+			"aaguid":          authenticator,
+			"authenticator":   aaguid.Name(authenticator),
+			"attestation":     attestationFormat,
+			"nickname":        nickname,
+			"clone_flag":      cloneFlag,
+			"sign_count":      signCount,
+			"backup_eligible": backupEligible,
+			"backup_state":    backupState,
+			"created_at":      createdAt,
+			"last_used_at":    lastUsedAt.Int64,
+		})
+	}
+	return credentials, rows.Err()
+}
+
+// DeleteCredential removes one of a user's passkeys by its row ID and
+// returns the user it belonged to and its base64url credential ID.
+func (db *DB) DeleteCredential(id int64) (int64, string, error) {
+	var userID int64
+	var credentialID []byte
+	if err := db.QueryRow("SELECT user_id, credential_id FROM credentials WHERE id = ?", id).Scan(&userID, &credentialID); err != nil {
+		return 0, "", err
+	}
+	result, err := db.Exec("DELETE FROM credentials WHERE id = ?", id)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, base64.RawURLEncoding.EncodeToString(credentialID), expectRows(result)
+}
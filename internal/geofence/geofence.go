@@ -0,0 +1,183 @@
+// Package geofence decides whether a location fix reported by a browser is
+// inside a door's geofence: a circle around the door or a GeoJSON polygon.
+package geofence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Reasons a fix is rejected. They are used as audit log reasons.
+const (
+	ReasonNoLocation  = "location_missing"
+	ReasonLowAccuracy = "low_accuracy"
+	ReasonOutside     = "outside_geofence"
+)
+
+const earthRadiusM = 6371000.0
+
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// Polygon is an outer ring followed by any holes, as in GeoJSON.
+type Polygon [][]Point
+
+type Fence struct {
+	Center  Point
+	RadiusM float64
+	// Polygons replace the circle when set. A fix is inside if it is inside
+	// any of them.
+	Polygons []Polygon
+	// MaxAccuracyM rejects fixes whose reported accuracy is worse than
+	// this, since they cannot tell inside from outside.
+	MaxAccuracyM float64
+}
+
+// Fix is a location as reported by the Geolocation API. AccuracyM is the
+// radius of 95% confidence around the point; 0 means no location.
+type Fix struct {
+	Point
+	AccuracyM float64
+}
+
+type Result struct {
+	// DistanceM is the distance from the fence's center.
+	DistanceM float64
+	// Reason is empty when the fix is inside the fence.
+	Reason string
+}
+
+// Check decides whether fix is inside the fence.
+func (f Fence) Check(fix Fix) Result {
+	result := Result{DistanceM: Distance(fix.Point, f.Center)}
+	switch {
+	case fix.AccuracyM <= 0 || math.IsNaN(fix.AccuracyM):
+		result.Reason = ReasonNoLocation
+	case f.MaxAccuracyM > 0 && fix.AccuracyM > f.MaxAccuracyM:
+		result.Reason = ReasonLowAccuracy
+	case !f.Contains(fix.Point):
+		result.Reason = ReasonOutside
+	}
+	return result
+}
+
+// Contains reports whether p is inside the polygons, or within RadiusM of
+// the center if there are none.
+func (f Fence) Contains(p Point) bool {
+	if len(f.Polygons) == 0 {
+		return Distance(p, f.Center) <= f.RadiusM
+	}
+	for _, polygon := range f.Polygons {
+		if polygon.contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains uses the even-odd rule, so points in a hole are outside. Edges
+// are treated as straight lines in latitude and longitude, which is
+// accurate enough at building scale.
+func (poly Polygon) contains(p Point) bool {
+	inside := false
+	for _, ring := range poly {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			a, b := ring[i], ring[j]
+			if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+				p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// Distance returns the great-circle distance between a and b in meters.
+func Distance(a, b Point) float64 {
+	dLat := (b.Lat - a.Lat) * math.Pi / 180
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.Lat*math.Pi/180)*math.Cos(b.Lat*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusM * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
+
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSON        `json:"geometry"`
+}
+
+// ParseGeoJSON reads a Polygon or MultiPolygon geometry, or a Feature with
+// one. Coordinates are [longitude, latitude] and rings must be closed.
+func ParseGeoJSON(raw []byte) ([]Polygon, error) {
+	var g geoJSON
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return nil, err
+	}
+	if g.Type == "Feature" {
+		if g.Geometry == nil {
+			return nil, errors.New("feature has no geometry")
+		}
+		g = *g.Geometry
+	}
+
+	var polygons [][][][]float64
+	switch g.Type {
+	case "Polygon":
+		var rings [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+			return nil, err
+		}
+		polygons = append(polygons, rings)
+	case "MultiPolygon":
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q, want Polygon or MultiPolygon", g.Type)
+	}
+	if len(polygons) == 0 {
+		return nil, errors.New("geometry has no polygons")
+	}
+
+	result := make([]Polygon, 0, len(polygons))
+	for _, rings := range polygons {
+		if len(rings) == 0 {
+			return nil, errors.New("polygon has no rings")
+		}
+		polygon := make(Polygon, 0, len(rings))
+		for _, positions := range rings {
+			ring, err := parseRing(positions)
+			if err != nil {
+				return nil, err
+			}
+			polygon = append(polygon, ring)
+		}
+		result = append(result, polygon)
+	}
+	return result, nil
+}
+
+func parseRing(positions [][]float64) ([]Point, error) {
+	if len(positions) < 4 {
+		return nil, errors.New("ring needs at least 4 positions")
+	}
+	ring := make([]Point, len(positions))
+	for i, pos := range positions {
+		if len(pos) < 2 {
+			return nil, errors.New("position needs longitude and latitude")
+		}
+		if pos[0] < -180 || pos[0] > 180 || pos[1] < -90 || pos[1] > 90 {
+			return nil, fmt.Errorf("position [%g, %g] is out of range", pos[0], pos[1])
+		}
+		ring[i] = Point{Lat: pos[1], Lon: pos[0]}
+	}
+	if ring[0] != ring[len(ring)-1] {
+		return nil, errors.New("ring is not closed")
+	}
+	return ring[:len(ring)-1], nil
+}
@@ -0,0 +1,162 @@
+package geofence
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// room is a square of about 27 by 22 meters with a square hole in the
+// middle, like a courtyard.
+const room = `{"type": "Polygon", "coordinates": [
+	[[4.8900, 52.3701], [4.8904, 52.3701], [4.8904, 52.3703], [4.8900, 52.3703], [4.8900, 52.3701]],
+	[[4.8901, 52.37015], [4.8903, 52.37015], [4.8903, 52.37025], [4.8901, 52.37025], [4.8901, 52.37015]]
+]}`
+
+func mustParse(t *testing.T, raw string) []Polygon {
+	t.Helper()
+	polygons, err := ParseGeoJSON([]byte(raw))
+	if err != nil {
+		t.Fatalf("ParseGeoJSON: %v", err)
+	}
+	return polygons
+}
+
+func TestFenceCheck(t *testing.T) {
+	center := Point{Lat: 52.3702, Lon: 4.8902}
+	circle := Fence{Center: center, RadiusM: 40, MaxAccuracyM: 50}
+	polygon := Fence{Center: center, Polygons: mustParse(t, room), MaxAccuracyM: 50}
+
+	tests := []struct {
+		name  string
+		fence Fence
+		fix   Fix
+		want  string
+	}{
+		{"circle center", circle, Fix{center, 10}, ""},
+		{"circle inside", circle, Fix{Point{52.3704, 4.8902}, 10}, ""},
+		{"circle outside", circle, Fix{Point{52.3710, 4.8902}, 10}, ReasonOutside},
+		{"circle far away", circle, Fix{Point{48.8566, 2.3522}, 10}, ReasonOutside},
+		{"polygon inside", polygon, Fix{Point{52.37012, 4.89005}, 10}, ""},
+		{"polygon outside", polygon, Fix{Point{52.3705, 4.8902}, 10}, ReasonOutside},
+		{"polygon just inside edge", polygon, Fix{Point{52.370101, 4.8902}, 10}, ""},
+		{"polygon just outside edge", polygon, Fix{Point{52.370099, 4.8902}, 10}, ReasonOutside},
+		{"polygon hole", polygon, Fix{center, 10}, ReasonOutside},
+		{"accuracy at the limit", circle, Fix{center, 50}, ""},
+		{"low accuracy", circle, Fix{center, 51}, ReasonLowAccuracy},
+		{"low accuracy outside", polygon, Fix{Point{52.3705, 4.8902}, 500}, ReasonLowAccuracy},
+		{"no accuracy limit", Fence{Center: center, RadiusM: 40}, Fix{center, 5000}, ""},
+		{"no location", circle, Fix{Point{}, 0}, ReasonNoLocation},
+		{"negative accuracy", circle, Fix{center, -1}, ReasonNoLocation},
+		{"NaN accuracy", circle, Fix{center, math.NaN()}, ReasonNoLocation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fence.Check(tt.fix).Reason; got != tt.want {
+				t.Errorf("Check(%+v) reason = %q, want %q", tt.fix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFenceCheckCircleEdge(t *testing.T) {
+	center := Point{Lat: 52.37, Lon: 4.89}
+	p := Point{Lat: 52.3703, Lon: 4.89}
+	d := Distance(center, p)
+
+	if r := (Fence{Center: center, RadiusM: d}).Check(Fix{p, 5}); r.Reason != "" {
+		t.Errorf("point on the circle: reason = %q, want inside", r.Reason)
+	}
+	if r := (Fence{Center: center, RadiusM: d - 0.5}).Check(Fix{p, 5}); r.Reason != ReasonOutside {
+		t.Errorf("point just outside the circle: reason = %q, want %q", r.Reason, ReasonOutside)
+	}
+	if r := (Fence{Center: center, RadiusM: d}).Check(Fix{p, 5}); math.Abs(r.DistanceM-d) > 1e-9 {
+		t.Errorf("DistanceM = %f, want %f", r.DistanceM, d)
+	}
+}
+
+func TestFenceCheckMultiPolygon(t *testing.T) {
+	fence := Fence{Polygons: mustParse(t, `{"type": "MultiPolygon", "coordinates": [
+		[[[4.8900, 52.3701], [4.8901, 52.3701], [4.8901, 52.3702], [4.8900, 52.3702], [4.8900, 52.3701]]],
+		[[[4.8910, 52.3701], [4.8911, 52.3701], [4.8911, 52.3702], [4.8910, 52.3702], [4.8910, 52.3701]]]
+	]}`)}
+
+	tests := []struct {
+		name string
+		p    Point
+		want string
+	}{
+		{"first polygon", Point{52.37015, 4.89005}, ""},
+		{"second polygon", Point{52.37015, 4.89105}, ""},
+		{"between them", Point{52.37015, 4.8905}, ReasonOutside},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fence.Check(Fix{tt.p, 5}).Reason; got != tt.want {
+				t.Errorf("reason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGeoJSON(t *testing.T) {
+	square := `[[4.89, 52.37], [4.891, 52.37], [4.891, 52.371], [4.89, 52.371], [4.89, 52.37]]`
+
+	tests := []struct {
+		name     string
+		raw      string
+		polygons int
+		rings    int
+	}{
+		{"polygon", `{"type": "Polygon", "coordinates": [` + square + `]}`, 1, 1},
+		{"polygon with hole", room, 1, 2},
+		{"feature", `{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [` + square + `]}}`, 1, 1},
+		{"multipolygon", `{"type": "MultiPolygon", "coordinates": [[` + square + `], [` + square + `]]}`, 2, 1},
+		{"position with altitude", `{"type": "Polygon", "coordinates": [[[4.89, 52.37, 3], [4.891, 52.37, 3], [4.891, 52.371, 3], [4.89, 52.37, 3]]]}`, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polygons := mustParse(t, tt.raw)
+			if len(polygons) != tt.polygons {
+				t.Fatalf("got %d polygons, want %d", len(polygons), tt.polygons)
+			}
+			if len(polygons[0]) != tt.rings {
+				t.Errorf("got %d rings, want %d", len(polygons[0]), tt.rings)
+			}
+			if last := polygons[0][0][len(polygons[0][0])-1]; last == polygons[0][0][0] {
+				t.Errorf("closing position was kept: %v", polygons[0][0])
+			}
+		})
+	}
+}
+
+func TestParseGeoJSONMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{"not JSON", `{"type": "Polygon"`, "unexpected end"},
+		{"point", `{"type": "Point", "coordinates": [4.89, 52.37]}`, "unsupported geometry type"},
+		{"missing type", `{"coordinates": []}`, "unsupported geometry type"},
+		{"feature without geometry", `{"type": "Feature", "properties": {}}`, "no geometry"},
+		{"feature with point", `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.89, 52.37]}}`, "unsupported geometry type"},
+		{"coordinates of the wrong shape", `{"type": "Polygon", "coordinates": [[4.89, 52.37]]}`, "cannot unmarshal"},
+		{"empty multipolygon", `{"type": "MultiPolygon", "coordinates": []}`, "no polygons"},
+		{"polygon without rings", `{"type": "Polygon", "coordinates": []}`, "no rings"},
+		{"too few positions", `{"type": "Polygon", "coordinates": [[[4.89, 52.37], [4.891, 52.37], [4.89, 52.37]]]}`, "at least 4 positions"},
+		{"unclosed ring", `{"type": "Polygon", "coordinates": [[[4.89, 52.37], [4.891, 52.37], [4.891, 52.371], [4.89, 52.371]]]}`, "not closed"},
+		{"position without latitude", `{"type": "Polygon", "coordinates": [[[4.89], [4.891, 52.37], [4.891, 52.371], [4.89, 52.37]]]}`, "longitude and latitude"},
+		{"latitude out of range", `{"type": "Polygon", "coordinates": [[[4.89, 92], [4.891, 52.37], [4.891, 52.371], [4.89, 92]]]}`, "out of range"},
+		{"swapped coordinates", `{"type": "Polygon", "coordinates": [[[52.37, 184.89], [52.37, 4.891], [52.371, 4.891], [52.37, 184.89]]]}`, "out of range"},
+		{"bad hole", `{"type": "Polygon", "coordinates": [[[4.89, 52.37], [4.891, 52.37], [4.891, 52.371], [4.89, 52.37]], [[4.8901, 52.3701], [4.8902, 52.3701], [4.8901, 52.3701]]]}`, "at least 4 positions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseGeoJSON([]byte(tt.raw))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseGeoJSON error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
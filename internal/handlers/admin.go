@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"database/sql"
+	"door-control/internal/db"
+	"door-control/internal/middleware"
+	"door-control/internal/models"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AdminHandler struct {
+	DB        *db.DB
+	Templates *template.Template
+}
+
+// bootstrapAdmins lists the usernames from ADMIN_USERNAMES, which are made
+// admins when they register or when the server starts.
+func bootstrapAdmins() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func isBootstrapAdmin(username string) bool {
+	for _, name := range bootstrapAdmins() {
+		if name == username {
+			return true
+		}
+	}
+	return false
+}
+
+// PromoteBootstrapAdmins gives every registered user in ADMIN_USERNAMES the
+// admin role.
+func PromoteBootstrapAdmins(database *db.DB) error {
+	n, err := database.PromoteUsers(bootstrapAdmins(), string(models.RoleAdmin))
+	if err == nil && n > 0 {
+		log.Printf("Promoted %d user(s) from ADMIN_USERNAMES to admin", n)
+	}
+	return err
+}
+
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.DB.ListUsers()
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+func (h *AdminHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request data", http.StatusBadRequest)
+		return
+	}
+
+	role, ok := models.ParseRole(requestData.Role)
+	if !ok {
+		http.Error(w, "Role must be member, staff or admin", http.StatusBadRequest)
+		return
+	}
+
+	current, err := h.DB.GetUserRole(userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading role for user ID %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if current == string(models.RoleAdmin) && role != models.RoleAdmin {
+		admins, err := h.DB.CountUsersWithRole(string(models.RoleAdmin))
+		if err != nil {
+			log.Printf("Error counting admins: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if admins <= 1 {
+			http.Error(w, "Cannot remove the last admin", http.StatusConflict)
+			return
+		}
+	}
+
+	if err := h.DB.SetUserRole(userID, string(role)); err != nil {
+		log.Printf("Error setting role for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to set role", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Role of user ID %d changed from %s to %s by admin ID %d", userID, current, role, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"user_id": userID,
+		"role":    role,
+	})
+}
+
+// bookingFilter reads the user, door, status, from and to query parameters.
+// Dates are either unix timestamps or YYYY-MM-DD days in the studio time
+// zone, with "to" including the whole day.
+func bookingFilter(r *http.Request) db.BookingFilter {
+	q := r.URL.Query()
+	f := db.BookingFilter{Status: q.Get("status")}
+	f.UserID, _ = strconv.ParseInt(q.Get("user"), 10, 64)
+	f.DoorID, _ = strconv.ParseInt(q.Get("door"), 10, 64)
+	f.From = parseFilterTime(q.Get("from"), 0)
+	f.To = parseFilterTime(q.Get("to"), 24*time.Hour)
+	return f
+}
+
+func parseFilterTime(v string, dayOffset time.Duration) int64 {
+	if v == "" {
+		return 0
+	}
+	if unix, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return unix
+	}
+	day, err := time.ParseInLocation("2006-01-02", v, studioLocation())
+	if err != nil {
+		return 0
+	}
+	return day.Add(dayOffset).Unix()
+}
+
+func (h *AdminHandler) ListBookings(w http.ResponseWriter, r *http.Request) {
+	bookings, err := h.DB.GetAllBookings(bookingFilter(r))
+	if err != nil {
+		log.Printf("Error listing bookings: %v", err)
+		http.Error(w, "Failed to list bookings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bookings)
+}
+
+func (h *AdminHandler) CancelBooking(w http.ResponseWriter, r *http.Request) {
+	staff, _ := middleware.UserFromContext(r.Context())
+
+	bookingID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+
+	booking, err := h.DB.GetBooking(bookingID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading booking %d: %v", bookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if booking["status"] != "active" {
+		http.Error(w, "Booking is already "+booking["status"].(string), http.StatusConflict)
+		return
+	}
+
+	if err := h.DB.CancelBooking(bookingID, staff.ID, time.Now().Unix()); err != nil {
+		log.Printf("Error cancelling booking %d: %v", bookingID, err)
+		http.Error(w, "Failed to cancel booking", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Booking %d of user ID %d cancelled by %s ID %d", bookingID, booking["user_id"], staff.Role, staff.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "success",
+		"booking_id": bookingID,
+	})
+}
+
+func (h *AdminHandler) SetUserStatus(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request data", http.StatusBadRequest)
+		return
+	}
+
+	if requestData.Status != "active" && requestData.Status != "disabled" {
+		http.Error(w, "Status must be active or disabled", http.StatusBadRequest)
+		return
+	}
+
+	if userID == admin.ID {
+		http.Error(w, "You cannot change your own status", http.StatusConflict)
+		return
+	}
+
+	current, err := h.DB.GetUserStatus(userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading status for user ID %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if current == "pending" || current == "rejected" {
+		http.Error(w, "This user is waiting for approval. Approve or reject them instead.", http.StatusConflict)
+		return
+	}
+
+	err = h.DB.SetUserStatus(userID, requestData.Status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error setting status for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to set status", http.StatusInternalServerError)
+		return
+	}
+
+	if requestData.Status != "active" {
+		if n, err := h.DB.RevokeUserSessions(userID, ""); err != nil {
+			log.Printf("Error revoking sessions of user ID %d: %v", userID, err)
+		} else if n > 0 {
+			log.Printf("Signed out %d sessions of disabled user ID %d", n, userID)
+		}
+	}
+
+	log.Printf("User ID %d set to %s by admin ID %d", userID, requestData.Status, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"user_id": userID,
+	})
+}
+
+func (h *AdminHandler) UserCredentials(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	credentials, err := h.DB.ListUserCredentials(userID)
+	if err != nil {
+		log.Printf("Error listing credentials for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to list credentials", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(credentials)
+}
+
+func (h *AdminHandler) RevokeCredential(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, credentialID, err := h.DB.DeleteCredential(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Credential not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking credential %d: %v", id, err)
+		http.Error(w, "Failed to revoke credential", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.DB.RevokeCredentialSessions(credentialID); err != nil {
+		log.Printf("Error revoking sessions of credential %d: %v", id, err)
+	}
+
+	log.Printf("Credential %d of user ID %d revoked by admin ID %d", id, userID, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"user_id": userID,
+	})
+}
+
+func (h *AdminHandler) UserSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.DB.ListUserSessions(userID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Error listing sessions for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *AdminHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.DB.RevokeSession(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking session %d: %v", id, err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Session %d of user ID %d revoked by admin ID %d", id, userID, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "success"})
+}
+
+func (h *AdminHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	n, err := h.DB.RevokeUserSessions(userID, "")
+	if err != nil {
+		log.Printf("Error revoking sessions of user ID %d: %v", userID, err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("All %d sessions of user ID %d revoked by admin ID %d", n, userID, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"revoked": n,
+	})
+}
+
+func (h *AdminHandler) UsersPage(w http.ResponseWriter, r *http.Request) {
+	current, _ := middleware.UserFromContext(r.Context())
+
+	users, err := h.DB.ListUsers()
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+
+	h.Templates.ExecuteTemplate(w, "admin_users.html", map[string]interface{}{
+		"Users":   users,
+		"IsAdmin": current.Role.Can(models.PermManageUsers),
+	})
+}
+
+func (h *AdminHandler) UserPage(w http.ResponseWriter, r *http.Request) {
+	current, _ := middleware.UserFromContext(r.Context())
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := h.DB.GetUser(userID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	credentials, err := h.DB.ListUserCredentials(userID)
+	if err != nil {
+		log.Printf("Error listing credentials for user ID %d: %v", userID, err)
+	}
+
+	bookings, err := h.DB.GetAllBookings(db.BookingFilter{UserID: userID})
+	if err != nil {
+		log.Printf("Error listing bookings for user ID %d: %v", userID, err)
+	}
+
+	userSessions, err := h.DB.ListUserSessions(userID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Error listing sessions for user ID %d: %v", userID, err)
+	}
+
+	recoveryCodes, err := h.DB.CountRecoveryCodes(userID)
+	if err != nil {
+		log.Printf("Error counting recovery codes for user ID %d: %v", userID, err)
+	}
+
+	h.Templates.ExecuteTemplate(w, "admin_user.html", map[string]interface{}{
+		"User":          user,
+		"Credentials":   credentials,
+		"Bookings":      bookings,
+		"Sessions":      userSessions,
+		"RecoveryCodes": recoveryCodes,
+		"IsAdmin":       current.Role.Can(models.PermManageUsers),
+		"IsSelf":        current.ID == userID,
+	})
+}
+
+func (h *AdminHandler) BookingsPage(w http.ResponseWriter, r *http.Request) {
+	filter := bookingFilter(r)
+
+	bookings, err := h.DB.GetAllBookings(filter)
+	if err != nil {
+		log.Printf("Error listing bookings: %v", err)
+		http.Error(w, "Failed to list bookings", http.StatusInternalServerError)
+		return
+	}
+
+	users, err := h.DB.ListUsers()
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+	}
+
+	doors, err := h.DB.ListDoors()
+	if err != nil {
+		log.Printf("Error listing doors: %v", err)
+	}
+
+	q := r.URL.Query()
+	h.Templates.ExecuteTemplate(w, "admin_bookings.html", map[string]interface{}{
+		"Bookings": bookings,
+		"Users":    users,
+		"Doors":    doors,
+		"Filter":   filter,
+		"From":     q.Get("from"),
+		"To":       q.Get("to"),
+	})
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"database/sql"
+	"door-control/internal/db"
+	"door-control/internal/middleware"
+	"door-control/internal/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func (h *AdminHandler) ApprovalsPage(w http.ResponseWriter, r *http.Request) {
+	current, _ := middleware.UserFromContext(r.Context())
+
+	users, err := h.DB.ListPendingUsers()
+	if err != nil {
+		log.Printf("Error listing pending users: %v", err)
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+
+	var pending, rejected []map[string]interface{}
+	for _, u := range users {
+		if u["status"] == "pending" {
+			pending = append(pending, u)
+		} else {
+			rejected = append(rejected, u)
+		}
+	}
+
+	h.Templates.ExecuteTemplate(w, "admin_approvals.html", map[string]interface{}{
+		"Pending":          pending,
+		"Rejected":         rejected,
+		"RegistrationMode": RegistrationMode(),
+		"IsAdmin":          current.Role.Can(models.PermManageUsers),
+	})
+}
+
+func (h *AdminHandler) ApproveUser(w http.ResponseWriter, r *http.Request) {
+	h.reviewUser(w, r, "active")
+}
+
+// RejectUser rejects a registration and signs the user out. An optional
+// reason is kept in the audit log.
+func (h *AdminHandler) RejectUser(w http.ResponseWriter, r *http.Request) {
+	h.reviewUser(w, r, "rejected")
+}
+
+func (h *AdminHandler) reviewUser(w http.ResponseWriter, r *http.Request, status string) {
+	admin, _ := middleware.UserFromContext(r.Context())
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, "Invalid request data", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = h.DB.ReviewUser(userID, status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found or not waiting for approval", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reviewing user ID %d: %v", userID, err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	adminName, _, _ := h.DB.GetUserByID(admin.ID)
+	event := db.AccessEvent{Type: db.EventApproval, UserID: userID}
+	if status == "active" {
+		event.Details = fmt.Sprintf("approved by %s", adminName)
+		recordAccess(h.DB, r, event, db.OutcomeAllowed, "")
+	} else {
+		event.Details = fmt.Sprintf("rejected by %s", adminName)
+		if reason := strings.TrimSpace(requestData.Reason); reason != "" {
+			event.Details += ": " + reason
+		}
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "rejected")
+
+		if _, err := h.DB.RevokeUserSessions(userID, ""); err != nil {
+			log.Printf("Error revoking sessions of user ID %d: %v", userID, err)
+		}
+	}
+
+	log.Printf("User ID %d set to %s by admin ID %d", userID, status, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "success",
+		"user_id":        userID,
+		"account_status": status,
+	})
+}
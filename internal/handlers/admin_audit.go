@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"door-control/internal/db"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultAuditLimit = 500
+
+func accessEventFilter(r *http.Request, limit int) db.AccessEventFilter {
+	q := r.URL.Query()
+	f := db.AccessEventFilter{
+		Type:    q.Get("type"),
+		Outcome: q.Get("outcome"),
+		Limit:   limit,
+	}
+	f.UserID, _ = strconv.ParseInt(q.Get("user"), 10, 64)
+	f.DoorID, _ = strconv.ParseInt(q.Get("door"), 10, 64)
+	f.From = parseFilterTime(q.Get("from"), 0)
+	f.To = parseFilterTime(q.Get("to"), 24*time.Hour)
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 {
+		f.Limit = n
+	}
+	return f
+}
+
+func (h *AdminHandler) AuditEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := h.DB.ListAccessEvents(accessEventFilter(r, defaultAuditLimit))
+	if err != nil {
+		log.Printf("Error listing access events: %v", err)
+		http.Error(w, "Failed to list access events", http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []db.AccessEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// ExportAudit streams every matching event as CSV; the limit only applies
+// when one is passed explicitly.
+func (h *AdminHandler) ExportAudit(w http.ResponseWriter, r *http.Request) {
+	events, err := h.DB.ListAccessEvents(accessEventFilter(r, 0))
+	if err != nil {
+		log.Printf("Error exporting access events: %v", err)
+		http.Error(w, "Failed to export access events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="access-events-%s.csv"`, time.Now().Format("20060102")))
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "time", "type", "outcome", "reason", "user_id", "username", "door_id", "door", "booking_id", "distance_m", "accuracy_m", "ip", "credential_id", "details"})
+	for _, e := range events {
+		cw.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			time.Unix(e.CreatedAt, 0).UTC().Format(time.RFC3339),
+			csvText(e.Type),
+			csvText(e.Outcome),
+			csvText(e.Reason),
+			formatOptionalID(e.UserID),
+			csvText(e.Username),
+			formatOptionalID(e.DoorID),
+			csvText(e.DoorName),
+			formatOptionalID(e.BookingID),
+			formatDistance(e.DistanceM),
+			formatDistance(e.AccuracyM),
+			csvText(e.IP),
+			csvText(e.CredentialID),
+			csvText(e.Details),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Error writing access event export: %v", err)
+	}
+}
+
+// csvText keeps spreadsheets from running user-supplied text as a formula
+// by prefixing cells that start with a formula character with a quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func formatOptionalID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+func formatDistance(m *float64) string {
+	if m == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*m, 'f', 1, 64)
+}
+
+func (h *AdminHandler) AuditPage(w http.ResponseWriter, r *http.Request) {
+	filter := accessEventFilter(r, defaultAuditLimit)
+
+	events, err := h.DB.ListAccessEvents(filter)
+	if err != nil {
+		log.Printf("Error listing access events: %v", err)
+		http.Error(w, "Failed to list access events", http.StatusInternalServerError)
+		return
+	}
+
+	users, err := h.DB.ListUsers()
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+	}
+
+	doors, err := h.DB.ListDoors()
+	if err != nil {
+		log.Printf("Error listing doors: %v", err)
+	}
+
+	q := r.URL.Query()
+	h.Templates.ExecuteTemplate(w, "admin_audit.html", map[string]interface{}{
+		"Events":    events,
+		"Users":     users,
+		"Doors":     doors,
+		"Filter":    filter,
+		"From":      q.Get("from"),
+		"To":        q.Get("to"),
+		"ExportURL": "/admin/audit/export?" + q.Encode(),
+	})
+}
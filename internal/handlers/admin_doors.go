@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"database/sql"
+	"door-control/internal/db"
+	"door-control/internal/middleware"
+	"door-control/internal/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type adminDoor struct {
+	db.Door
+	HasDisplayLink bool
+}
+
+// DoorsPage lists the doors and their unlock requirements. Admins can also
+// create and replace the display links of doors that use QR codes.
+func (h *AdminHandler) DoorsPage(w http.ResponseWriter, r *http.Request) {
+	current, _ := middleware.UserFromContext(r.Context())
+
+	doors, err := h.DB.ListDoors()
+	if err != nil {
+		log.Printf("Error listing doors: %v", err)
+		http.Error(w, "Failed to list doors", http.StatusInternalServerError)
+		return
+	}
+	withLink, err := h.DB.DoorsWithDisplayToken()
+	if err != nil {
+		log.Printf("Error listing display links: %v", err)
+	}
+
+	rows := make([]adminDoor, 0, len(doors))
+	for _, door := range doors {
+		rows = append(rows, adminDoor{Door: door, HasDisplayLink: withLink[door.ID]})
+	}
+
+	h.Templates.ExecuteTemplate(w, "admin_doors.html", map[string]interface{}{
+		"Doors":               rows,
+		"IsAdmin":             current.Role.Can(models.PermManageDoors),
+		"DefaultMaxAccuracyM": defaultMaxAccuracyM,
+	})
+}
+
+// ResetDisplayLink creates a new display link for a door. The previous link
+// stops working, so a display that was lost or seen by others can be shut
+// out. The link is only returned here.
+func (h *AdminHandler) ResetDisplayLink(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+
+	doorID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid door ID", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.DB.ResetDisplayToken(doorID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Door not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error resetting display link of door %d: %v", doorID, err)
+		http.Error(w, "Failed to create display link", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Display link of door %d replaced by admin ID %d", doorID, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"path":   displayPath(doorID, token),
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"database/sql"
+	"door-control/internal/middleware"
+	"door-control/internal/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (h *AdminHandler) IncidentsPage(w http.ResponseWriter, r *http.Request) {
+	current, _ := middleware.UserFromContext(r.Context())
+
+	incidents, err := h.DB.ListCloneIncidents()
+	if err != nil {
+		log.Printf("Error listing clone incidents: %v", err)
+		http.Error(w, "Failed to list incidents", http.StatusInternalServerError)
+		return
+	}
+
+	h.Templates.ExecuteTemplate(w, "admin_incidents.html", map[string]interface{}{
+		"Incidents":   incidents,
+		"ClonePolicy": ClonePolicy(),
+		"IsAdmin":     current.Role.Can(models.PermManageUsers),
+	})
+}
+
+// ResolveIncident closes a clone incident and lifts the flag from the
+// passkey, for when the counter problem turned out to be harmless. Passkeys
+// that really were copied should be revoked instead.
+func (h *AdminHandler) ResolveIncident(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid incident ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.DB.ResolveCloneIncident(id, admin.ID, time.Now().Unix())
+	if err == sql.ErrNoRows {
+		http.Error(w, "Incident not found or already resolved", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving clone incident %d: %v", id, err)
+		http.Error(w, "Failed to resolve incident", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Clone incident %d of user ID %d resolved by admin ID %d", id, userID, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "success"})
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"door-control/internal/db"
+	"door-control/internal/middleware"
+	"door-control/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxInviteUses = 1000
+
+func (h *AdminHandler) InvitesPage(w http.ResponseWriter, r *http.Request) {
+	current, _ := middleware.UserFromContext(r.Context())
+
+	invites, err := h.DB.ListInvites()
+	if err != nil {
+		log.Printf("Error listing invites: %v", err)
+		http.Error(w, "Failed to list invites", http.StatusInternalServerError)
+		return
+	}
+
+	h.Templates.ExecuteTemplate(w, "admin_invites.html", map[string]interface{}{
+		"Invites":          invites,
+		"Now":              time.Now().Unix(),
+		"RegistrationMode": RegistrationMode(),
+		"IsAdmin":          current.Role.Can(models.PermManageUsers),
+		"CanSetRole":       current.Role.Can(models.PermManageRoles),
+	})
+}
+
+func (h *AdminHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	invites, err := h.DB.ListInvites()
+	if err != nil {
+		log.Printf("Error listing invites: %v", err)
+		http.Error(w, "Failed to list invites", http.StatusInternalServerError)
+		return
+	}
+	if invites == nil {
+		invites = []db.Invite{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invites)
+}
+
+// CreateInvite issues an invite link. The token is returned once and only
+// its hash is stored.
+func (h *AdminHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+
+	var requestData struct {
+		DisplayName  string `json:"display_name"`
+		Role         string `json:"role"`
+		MaxUses      int    `json:"max_uses"`
+		ExpiresHours int    `json:"expires_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request data", http.StatusBadRequest)
+		return
+	}
+
+	inv := db.Invite{
+		DisplayName: strings.TrimSpace(requestData.DisplayName),
+		Role:        string(models.RoleMember),
+		MaxUses:     requestData.MaxUses,
+		CreatedBy:   admin.ID,
+		CreatedAt:   time.Now().Unix(),
+	}
+	if len(inv.DisplayName) > maxDisplayNameLength {
+		http.Error(w, "Display name is too long", http.StatusBadRequest)
+		return
+	}
+	if inv.MaxUses == 0 {
+		inv.MaxUses = 1
+	}
+	if inv.MaxUses < 1 || inv.MaxUses > maxInviteUses {
+		http.Error(w, "Uses must be between 1 and 1000", http.StatusBadRequest)
+		return
+	}
+	if requestData.ExpiresHours < 0 {
+		http.Error(w, "Invalid expiry", http.StatusBadRequest)
+		return
+	}
+	if requestData.ExpiresHours > 0 {
+		inv.ExpiresAt = inv.CreatedAt + int64(requestData.ExpiresHours)*3600
+	}
+
+	if requestData.Role != "" {
+		role, ok := models.ParseRole(requestData.Role)
+		if !ok {
+			http.Error(w, "Role must be member, staff or admin", http.StatusBadRequest)
+			return
+		}
+		if role != models.RoleMember && !admin.Role.Can(models.PermManageRoles) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		inv.Role = string(role)
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Error generating invite token: %v", err)
+		http.Error(w, "Failed to create invite", http.StatusInternalServerError)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	id, err := h.DB.CreateInvite(inv, hashInviteToken(token))
+	if err != nil {
+		log.Printf("Error creating invite: %v", err)
+		http.Error(w, "Failed to create invite", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Invite %d (%s, %d uses) created by admin ID %d", id, inv.Role, inv.MaxUses, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"id":     id,
+		"token":  token,
+		"path":   "/register?invite=" + token,
+	})
+}
+
+func (h *AdminHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.DB.RevokeInvite(id, time.Now().Unix())
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invite not found or already revoked", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking invite %d: %v", id, err)
+		http.Error(w, "Failed to revoke invite", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Invite %d revoked by admin ID %d", id, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"door-control/internal/db"
+	"door-control/internal/middleware"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// recordAccess stores an access decision in the audit log. Failing to write
+// the log is reported but never changes the decision itself.
+func recordAccess(database *db.DB, r *http.Request, e db.AccessEvent, outcome, reason string) {
+	e.CreatedAt = time.Now().Unix()
+	e.Outcome = outcome
+	e.Reason = reason
+	e.IP = middleware.ClientIP(r)
+	if err := database.RecordAccessEvent(e); err != nil {
+		log.Printf("Error recording %s access event: %v", e.Type, err)
+	}
+}
+
+// sessionCredential is the passkey the session was authenticated with.
+func sessionCredential(sess *sessions.Session) string {
+	id, _ := sess.Values["credentialID"].(string)
+	return id
+}
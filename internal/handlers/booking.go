@@ -1,46 +1,59 @@
 package handlers
 
 import (
+	"database/sql"
+	"door-control/internal/actuator"
 	"door-control/internal/db"
+	"door-control/internal/models"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"log"
-	"math"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gorilla/sessions"
 )
 
 type BookingHandler struct {
 	DB        *db.DB
-	Store     *sessions.CookieStore
+	WebAuthn  *webauthn.WebAuthn
+	Store     sessions.Store
 	Templates *template.Template
+	Actuators *actuator.Registry
+	// GuestSecret signs guest links.
+	GuestSecret []byte
+	// PresenceSecret derives the door codes.
+	PresenceSecret []byte
 }
 
-const (
-	maxDistanceKm = 0.05
-)
-
-func getStudioCoordinates() (float64, float64) {
-	lat := 0.0
-	lon := 0.0
+var errDoorRequired = errors.New("door required")
 
-	if latStr := os.Getenv("STUDIO_LATITUDE"); latStr != "" {
-		if parsed, err := strconv.ParseFloat(latStr, 64); err == nil {
-			lat = parsed
-		}
+// resolveDoor looks up the requested door. Clients written before doors
+// existed send no door ID, which is accepted as long as there is only one
+// candidate door.
+func (h *BookingHandler) resolveDoor(doorID int64, bookableOnly bool) (db.Door, error) {
+	if doorID != 0 {
+		return h.DB.GetDoor(doorID)
 	}
 
-	if lonStr := os.Getenv("STUDIO_LONGITUDE"); lonStr != "" {
-		if parsed, err := strconv.ParseFloat(lonStr, 64); err == nil {
-			lon = parsed
-		}
+	var doors []db.Door
+	var err error
+	if bookableOnly {
+		doors, err = h.DB.ListBookableDoors()
+	} else {
+		doors, err = h.DB.ListDoors()
 	}
-
-	return lat, lon
+	if err != nil {
+		return db.Door{}, err
+	}
+	if len(doors) != 1 {
+		return db.Door{}, errDoorRequired
+	}
+	return doors[0], nil
 }
 
 func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
@@ -60,9 +73,23 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Booking creation attempt by user ID: %d from IP: %s", userID, r.RemoteAddr)
 
+	event := db.AccessEvent{
+		Type:         db.EventBooking,
+		UserID:       userID,
+		CredentialID: sessionCredential(sess),
+	}
+
+	if !accountActive(w, h.DB, userID) {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "account_inactive")
+		return
+	}
+
 	var requestData struct {
-		StartTime int64 `json:"start_time"`
-		EndTime   int64 `json:"end_time"`
+		DoorID    int64   `json:"door_id"`
+		StartTime int64   `json:"start_time"`
+		EndTime   int64   `json:"end_time"`
+		RRule     string  `json:"rrule"`
+		ExDates   []int64 `json:"exdates"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
@@ -75,27 +102,55 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conflict, err := h.DB.CheckBookingConflict(userID, requestData.StartTime, requestData.EndTime)
+	if requestData.EndTime <= requestData.StartTime {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return
+	}
+
+	door, err := h.resolveDoor(requestData.DoorID, true)
+	if err == errDoorRequired {
+		http.Error(w, "Please choose a room", http.StatusBadRequest)
+		return
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Unknown room", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Printf("Error checking booking conflict for user ID %d: %v", userID, err)
+		log.Printf("Error resolving door %d: %v", requestData.DoorID, err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
+	event.DoorID = door.ID
+
+	if door.Entrance {
+		http.Error(w, "Entrances cannot be booked, please choose a room", http.StatusBadRequest)
+		return
+	}
 
-	if conflict {
-		log.Printf("Booking conflict detected for user ID %d: start=%d, end=%d", userID, requestData.StartTime, requestData.EndTime)
-		http.Error(w, "Booking conflict - you already have a booking during this time", http.StatusConflict)
+	if requestData.RRule != "" {
+		h.createSeries(w, r, event, door, requestData.RRule, requestData.StartTime, requestData.EndTime, requestData.ExDates)
 		return
 	}
 
-	bookingID, err := h.DB.CreateBooking(userID, requestData.StartTime, requestData.EndTime, time.Now().Unix())
+	bookingID, err := h.DB.CreateBooking(userID, door.ID, requestData.StartTime, requestData.EndTime, time.Now().Unix())
+	if writeBookingConflict(w, err, door) {
+		log.Printf("Booking conflict detected for user ID %d at %s: start=%d, end=%d - %v", userID, door.Name, requestData.StartTime, requestData.EndTime, err)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, bookingConflictReason(err))
+		return
+	}
 	if err != nil {
 		log.Printf("Error creating booking for user ID %d: %v", userID, err)
+		recordAccess(h.DB, r, event, db.OutcomeError, "database_error")
 		http.Error(w, "Failed to create booking", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Booking created successfully - ID: %d, User ID: %d, Start: %d, End: %d", bookingID, userID, requestData.StartTime, requestData.EndTime)
+	event.BookingID = bookingID
+	event.Details = fmt.Sprintf("%d-%d", requestData.StartTime, requestData.EndTime)
+	recordAccess(h.DB, r, event, db.OutcomeAllowed, "")
+
+	log.Printf("Booking created successfully - ID: %d, User ID: %d, Door: %s, Start: %d, End: %d", bookingID, userID, door.Name, requestData.StartTime, requestData.EndTime)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -128,26 +183,182 @@ func (h *BookingHandler) GetUserBookings(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(bookings)
 }
 
-func (h *BookingHandler) UnlockDoor(w http.ResponseWriter, r *http.Request) {
+// writeBookingConflict answers 409 for the conflict errors returned by the
+// booking queries and reports whether it did.
+func writeBookingConflict(w http.ResponseWriter, err error, door db.Door) bool {
+	when := "during this time"
+	var occErr *db.OccurrenceError
+	if errors.As(err, &occErr) {
+		when = "on " + time.Unix(occErr.Start, 0).In(studioLocation()).Format("Mon 2 Jan 2006 15:04")
+	}
+
+	switch {
+	case errors.Is(err, db.ErrBookingConflict):
+		http.Error(w, "Booking conflict - you already have a booking "+when, http.StatusConflict)
+	case errors.Is(err, db.ErrRoomFull):
+		room := door.Name
+		if room == "" {
+			room = "This room"
+		}
+		http.Error(w, fmt.Sprintf("%s is fully booked %s", room, when), http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
+
+// accountActive refuses users an admin has disabled. It writes the error
+// response itself and reports whether the request may continue.
+func accountActive(w http.ResponseWriter, database *db.DB, userID int64) bool {
+	status, err := database.GetUserStatus(userID)
+	if err != nil {
+		log.Printf("Error loading status for user ID %d: %v", userID, err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if status != "active" {
+		log.Printf("Request denied: user ID %d is %s", userID, status)
+		http.Error(w, accountStatusMessage(status), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// accountCanSignIn is like accountActive but also lets users who are still
+// waiting for approval through, so they can sign in and manage their
+// passkeys before they can book or unlock.
+func accountCanSignIn(w http.ResponseWriter, database *db.DB, userID int64) bool {
+	status, err := database.GetUserStatus(userID)
+	if err != nil {
+		log.Printf("Error loading status for user ID %d: %v", userID, err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if status != "active" && status != "pending" {
+		log.Printf("Request denied: user ID %d is %s", userID, status)
+		http.Error(w, accountStatusMessage(status), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func accountStatusMessage(status string) string {
+	switch status {
+	case "pending":
+		return "Your account is waiting for approval by the studio."
+	case "rejected":
+		return "Your registration was not approved. Please contact the studio."
+	}
+	return "Your account has been disabled. Please contact the studio."
+}
+
+// can reports whether the user's role grants perm.
+func (h *BookingHandler) can(userID int64, perm models.Permission) bool {
+	role, err := h.DB.GetUserRole(userID)
+	if err != nil {
+		log.Printf("Error loading role for user ID %d: %v", userID, err)
+		return false
+	}
+	return models.Role(role).Can(perm)
+}
+
+func bookingConflictReason(err error) string {
+	if errors.Is(err, db.ErrRoomFull) {
+		return "room_full"
+	}
+	return "overlapping_booking"
+}
+
+// ownedBooking loads the booking named in the URL and checks that it belongs
+// to the signed-in user, or that the user may manage all bookings. It
+// writes the error response itself and returns ok=false when the request
+// must not continue.
+func (h *BookingHandler) ownedBooking(w http.ResponseWriter, r *http.Request) (int64, map[string]interface{}, bool) {
 	sess, err := h.Store.Get(r, "webauthn-session")
 	if err != nil || sess.Values["authenticated"] != true {
-		log.Printf("Door unlock denied: unauthorized from IP: %s", r.RemoteAddr)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return 0, nil, false
 	}
 
 	userID, ok := sess.Values["userID"].(int64)
 	if !ok {
-		log.Printf("Door unlock denied: invalid session from IP: %s", r.RemoteAddr)
 		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	if !accountActive(w, h.DB, userID) {
+		return 0, nil, false
+	}
+
+	bookingID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	booking, err := h.DB.GetBooking(bookingID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return 0, nil, false
+	}
+	if err != nil {
+		log.Printf("Error loading booking %d: %v", bookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, nil, false
+	}
+
+	if booking["user_id"].(int64) != userID && !h.can(userID, models.PermManageBookings) {
+		log.Printf("Booking change denied: user ID %d does not own booking %d, IP: %s", userID, bookingID, r.RemoteAddr)
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return 0, nil, false
+	}
+
+	return userID, booking, true
+}
+
+func (h *BookingHandler) CancelBooking(w http.ResponseWriter, r *http.Request) {
+	userID, booking, ok := h.ownedBooking(w, r)
+	if !ok {
 		return
 	}
+	bookingID := booking["id"].(int64)
 
-	log.Printf("Door unlock attempt by user ID: %d from IP: %s", userID, r.RemoteAddr)
+	if booking["status"] != "active" {
+		http.Error(w, "Booking is already "+booking["status"].(string), http.StatusConflict)
+		return
+	}
+
+	now := time.Now().Unix()
+	if booking["end_time"].(int64) <= now {
+		http.Error(w, "Booking has already ended", http.StatusConflict)
+		return
+	}
+
+	if err := h.DB.CancelBooking(bookingID, userID, now); err != nil {
+		log.Printf("Error cancelling booking %d for user ID %d: %v", bookingID, userID, err)
+		http.Error(w, "Failed to cancel booking", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Booking cancelled - ID: %d, by User ID: %d, IP: %s", bookingID, userID, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "success",
+		"booking_id": bookingID,
+	})
+}
+
+func (h *BookingHandler) UpdateBooking(w http.ResponseWriter, r *http.Request) {
+	userID, booking, ok := h.ownedBooking(w, r)
+	if !ok {
+		return
+	}
+	bookingID := booking["id"].(int64)
 
 	var requestData struct {
-		Latitude  float64 `json:"latitude"`
-		Longitude float64 `json:"longitude"`
+		StartTime int64 `json:"start_time"`
+		EndTime   int64 `json:"end_time"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
@@ -155,49 +366,67 @@ func (h *BookingHandler) UnlockDoor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentTime := time.Now().Unix()
-	booking, err := h.DB.GetActiveBooking(userID, currentTime)
-	if err != nil {
-		log.Printf("Door unlock denied for user ID %d: no active booking found - %v", userID, err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  "error",
-			"message": "No active booking found. Please book a time slot first.",
-		})
+	if requestData.StartTime == 0 || requestData.EndTime == 0 {
+		http.Error(w, "Start time and end time required", http.StatusBadRequest)
+		return
+	}
+
+	if requestData.EndTime <= requestData.StartTime {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
 		return
 	}
 
-	studioLat, studioLon := getStudioCoordinates()
-	distance := haversine(requestData.Latitude, requestData.Longitude, studioLat, studioLon)
+	if booking["status"] != "active" {
+		http.Error(w, "Only active bookings can be changed", http.StatusConflict)
+		return
+	}
 
-	log.Printf("Door unlock location check - User ID: %d, Distance: %.3f km, Location: (%.6f, %.6f)",
-		userID, distance, requestData.Latitude, requestData.Longitude)
+	now := time.Now().Unix()
+	if booking["end_time"].(int64) <= now {
+		http.Error(w, "Booking has already ended", http.StatusConflict)
+		return
+	}
 
-	if distance > maxDistanceKm {
-		log.Printf("Door unlock denied for user ID %d: too far from studio (%.3f km > %.3f km)", userID, distance, maxDistanceKm)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":        "error",
-			"message":       "Please go to the front door for the door to open.",
-			"distance":      distance,
-			"show_navigate": true,
-			"maps_url":      "https://maps.app.goo.gl/isQ32SzqMjS4PQxD8",
-			"studio_lat":    studioLat,
-			"studio_lon":    studioLon,
-		})
+	err := h.DB.RescheduleBooking(bookingID, userID, requestData.StartTime, requestData.EndTime, now)
+	if err == db.ErrBookingConflict || err == db.ErrRoomFull {
+		log.Printf("Booking reschedule conflict for user ID %d: booking=%d, start=%d, end=%d - %v", userID, bookingID, requestData.StartTime, requestData.EndTime, err)
+		door, _ := h.DB.GetDoor(booking["door_id"].(int64))
+		writeBookingConflict(w, err, door)
+		return
+	}
+	if err != nil {
+		log.Printf("Error rescheduling booking %d for user ID %d: %v", bookingID, userID, err)
+		http.Error(w, "Failed to update booking", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("✓ DOOR UNLOCKED - User ID: %d, Booking ID: %v, Distance: %.3f km, IP: %s",
-		userID, booking["id"], distance, r.RemoteAddr)
+	log.Printf("Booking rescheduled - ID: %d, by User ID: %d, Start: %d -> %d, End: %d -> %d",
+		bookingID, userID, booking["start_time"], requestData.StartTime, booking["end_time"], requestData.EndTime)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "success",
-		"message": "Door unlocked! Welcome to Waterhouse Studios.",
+		"status":     "success",
+		"booking_id": bookingID,
 	})
 }
 
+func (h *BookingHandler) BookingHistory(w http.ResponseWriter, r *http.Request) {
+	_, booking, ok := h.ownedBooking(w, r)
+	if !ok {
+		return
+	}
+
+	changes, err := h.DB.GetBookingChanges(booking["id"].(int64))
+	if err != nil {
+		log.Printf("Error getting booking changes: %v", err)
+		http.Error(w, "Failed to get booking history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
 func (h *BookingHandler) BookingPage(w http.ResponseWriter, r *http.Request) {
 	sess, err := h.Store.Get(r, "webauthn-session")
 	if err != nil || sess.Values["authenticated"] != true {
@@ -209,20 +438,12 @@ func (h *BookingHandler) BookingPage(w http.ResponseWriter, r *http.Request) {
 	userID, _ := sess.Values["userID"].(int64)
 	log.Printf("Booking page accessed by user ID: %d from IP: %s", userID, r.RemoteAddr)
 
-	h.Templates.ExecuteTemplate(w, "booking.html", nil)
-}
-
-func haversine(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371.0
-
-	dLat := (lat2 - lat1) * math.Pi / 180.0
-	dLon := (lon2 - lon1) * math.Pi / 180.0
-
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1*math.Pi/180.0)*math.Cos(lat2*math.Pi/180.0)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
-
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	doors, err := h.DB.ListBookableDoors()
+	if err != nil {
+		log.Printf("Error listing doors: %v", err)
+	}
 
-	return R * c
+	h.Templates.ExecuteTemplate(w, "booking.html", map[string]interface{}{
+		"Doors": doors,
+	})
 }
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"door-control/internal/db"
+	"door-control/internal/ical"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+type CalendarHandler struct {
+	DB    *db.DB
+	Store sessions.Store
+	// Domain makes event UIDs globally unique; it must not change or
+	// subscribed calendars will duplicate every booking.
+	Domain     string
+	AdminToken string
+}
+
+// Feed serves /calendar/{token}.ics. The token is either a user's calendar
+// token or the studio-wide ADMIN_CALENDAR_TOKEN. User feeds are only served
+// while the user is active.
+func (h *CalendarHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(r.PathValue("file"), ".ics")
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var cal ical.Calendar
+	var bookings []map[string]interface{}
+	var err error
+	admin := h.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) == 1
+	if admin {
+		cal.Name = "Waterhouse Studios - all bookings"
+		bookings, err = h.DB.GetAllBookings(db.BookingFilter{})
+	} else {
+		var userID int64
+		var status string
+		userID, _, status, err = h.DB.GetUserByCalendarToken(token)
+		if err == sql.ErrNoRows {
+			log.Printf("Calendar feed denied: unknown token from IP: %s", r.RemoteAddr)
+			http.NotFound(w, r)
+			return
+		}
+		if err == nil && status != "active" {
+			log.Printf("Calendar feed denied: user ID %d is %s, IP: %s", userID, status, r.RemoteAddr)
+			http.NotFound(w, r)
+			return
+		}
+		if err == nil {
+			cal.Name = "Waterhouse Studios"
+			bookings, err = h.DB.GetUserBookings(userID)
+		}
+	}
+	if err != nil {
+		log.Printf("Error building calendar feed: %v", err)
+		http.Error(w, "Failed to build calendar", http.StatusInternalServerError)
+		return
+	}
+
+	for _, b := range bookings {
+		cal.Events = append(cal.Events, h.bookingEvent(b, admin))
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := cal.WriteTo(w); err != nil {
+		log.Printf("Error writing calendar feed: %v", err)
+	}
+}
+
+func (h *CalendarHandler) bookingEvent(b map[string]interface{}, admin bool) ical.Event {
+	room := b["door_name"].(string)
+	if room == "" {
+		room = "Studio"
+	}
+
+	summary := "Studio session - " + room
+	if admin {
+		summary = fmt.Sprintf("%s: %s", room, b["display_name"])
+	}
+
+	location := room
+	if site := b["site"].(string); site != "" && site != "main" {
+		location += ", " + site
+	}
+
+	e := ical.Event{
+		UID:       fmt.Sprintf("booking-%d@%s", b["id"], h.Domain),
+		Summary:   summary,
+		Location:  location,
+		Start:     time.Unix(b["start_time"].(int64), 0),
+		End:       time.Unix(b["end_time"].(int64), 0),
+		Cancelled: b["status"] == "cancelled",
+		Created:   time.Unix(b["created_at"].(int64), 0),
+	}
+	if changed := b["last_change_at"].(int64); changed != 0 {
+		e.LastModified = time.Unix(changed, 0)
+	}
+	if b["series_id"].(int64) != 0 {
+		e.Description = "Part of a recurring booking"
+	}
+	return e
+}
+
+// ResetToken issues a new calendar token for the signed-in user, which
+// invalidates the old feed URL. The new URL is only shown in the response.
+func (h *CalendarHandler) ResetToken(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.DB.ResetCalendarToken(userID)
+	if err != nil {
+		log.Printf("Error resetting calendar token for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to reset calendar link", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Calendar link reset by user ID: %d from IP: %s", userID, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"url":    calendarPath(token),
+	})
+}
+
+func calendarPath(token string) string {
+	return "/calendar/" + token + ".ics"
+}
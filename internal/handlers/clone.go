@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bytes"
+	"door-control/internal/db"
+	"door-control/internal/middleware"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// ClonePolicy returns CLONE_POLICY, which decides what happens when a
+// passkey's signature counter does not advance, a sign that it was copied:
+// "log" (the default) only records an incident, "reregister" stops the
+// passkey from unlocking doors so the member has to register a new one,
+// "suspend" also refuses logins with it and signs out its sessions, and
+// "alert" blocks unlocking until an admin has reviewed the incident and
+// posts it to CLONE_ALERT_WEBHOOK.
+func ClonePolicy() string {
+	switch policy := os.Getenv("CLONE_POLICY"); policy {
+	case "reregister", "suspend", "alert":
+		return policy
+	}
+	return "log"
+}
+
+func cloneFlag(policy string) string {
+	switch policy {
+	case "reregister":
+		return db.CloneFlagReregister
+	case "suspend":
+		return db.CloneFlagSuspended
+	case "alert":
+		return db.CloneFlagReview
+	}
+	return ""
+}
+
+// cloneFlagMessage explains to the member why a flagged passkey cannot be
+// used to unlock doors.
+func cloneFlagMessage(flag string) string {
+	switch flag {
+	case db.CloneFlagReregister:
+		return "This passkey may have been copied and can no longer unlock doors. Add a new passkey on the Passkeys page, sign in with it and delete this one."
+	case db.CloneFlagReview:
+		return "This passkey may have been copied. Doors stay locked for it until the studio has reviewed this."
+	}
+	return "This passkey has been suspended because it may have been copied. Sign in with another passkey or a recovery code."
+}
+
+// handleCloneWarning records a clone incident for a login and applies the
+// clone policy to the passkey.
+func handleCloneWarning(database *db.DB, r *http.Request, event *db.AccessEvent, credential *webauthn.Credential) {
+	policy := ClonePolicy()
+	inc := db.CloneIncident{
+		UserID:         event.UserID,
+		CredentialID:   base64.RawURLEncoding.EncodeToString(credential.ID),
+		CredentialFlag: cloneFlag(policy),
+		SignCount:      int64(credential.Authenticator.SignCount),
+		Action:         policy,
+		IP:             middleware.ClientIP(r),
+		CreatedAt:      time.Now().Unix(),
+	}
+
+	log.Printf("WARNING: Clone detected for credential ID: %s (User ID: %d), policy %s", inc.CredentialID, inc.UserID, policy)
+	event.Details = "clone warning, policy " + policy
+
+	id, err := database.RecordCloneIncident(inc, inc.CredentialFlag)
+	if err != nil {
+		log.Printf("Error recording clone incident for user ID %d: %v", inc.UserID, err)
+		return
+	}
+	inc.ID = id
+
+	switch policy {
+	case "suspend":
+		if n, err := database.RevokeCredentialSessions(inc.CredentialID); err != nil {
+			log.Printf("Error revoking sessions of credential %s: %v", inc.CredentialID, err)
+		} else if n > 0 {
+			log.Printf("Signed out %d sessions opened with suspended credential %s", n, inc.CredentialID)
+		}
+	case "alert":
+		inc.Username, _, _ = database.GetUserByID(inc.UserID)
+		go alertAdmins(inc)
+	}
+}
+
+// alertAdmins posts a clone incident as JSON to CLONE_ALERT_WEBHOOK.
+func alertAdmins(inc db.CloneIncident) {
+	url := os.Getenv("CLONE_ALERT_WEBHOOK")
+	if url == "" {
+		log.Printf("Clone incident %d needs review on /admin/incidents (CLONE_ALERT_WEBHOOK is not set)", inc.ID)
+		return
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"event":    "clone_detected",
+		"text":     fmt.Sprintf("Passkey of %s may have been cloned (incident %d)", inc.Username, inc.ID),
+		"incident": inc,
+	})
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error sending clone alert for incident %d: %v", inc.ID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Clone alert for incident %d was answered with %s", inc.ID, resp.Status)
+	}
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"database/sql"
+	"door-control/internal/attestation"
+	"door-control/internal/db"
+	"door-control/internal/models"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/sessions"
+)
+
+const maxNicknameLength = 64
+
+// CredentialsHandler lets signed-in users manage their passkeys.
+type CredentialsHandler struct {
+	DB          *db.DB
+	WebAuthn    *webauthn.WebAuthn
+	Store       sessions.Store
+	Templates   *template.Template
+	Attestation *attestation.Policy
+}
+
+// checkAttestation applies the attestation policy to a newly registered
+// passkey and responds with 403 if it is turned down.
+func checkAttestation(w http.ResponseWriter, policy *attestation.Policy, who string, credential *webauthn.Credential) bool {
+	if policy == nil {
+		return true
+	}
+	if err := policy.Check(credential); err != nil {
+		log.Printf("Passkey for %s turned down: %v", who, err)
+		http.Error(w, "Passkey not accepted, "+err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (h *CredentialsHandler) currentUser(w http.ResponseWriter, r *http.Request) (*sessions.Session, int64, bool) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, 0, false
+	}
+
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return nil, 0, false
+	}
+
+	if !accountCanSignIn(w, h.DB, userID) {
+		return nil, 0, false
+	}
+	return sess, userID, true
+}
+
+func parseNickname(w http.ResponseWriter, nickname string) (string, bool) {
+	nickname = strings.TrimSpace(nickname)
+	if len(nickname) > maxNicknameLength {
+		http.Error(w, "Nickname is too long", http.StatusBadRequest)
+		return "", false
+	}
+	return nickname, true
+}
+
+func (h *CredentialsHandler) CredentialsPage(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	credentials, err := h.DB.ListUserCredentials(userID)
+	if err != nil {
+		log.Printf("Error listing passkeys for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to load passkeys", http.StatusInternalServerError)
+		return
+	}
+
+	current, _ := sess.Values["credentialID"].(string)
+	for _, c := range credentials {
+		c["current"] = c["credential_id"] == current
+	}
+
+	h.Templates.ExecuteTemplate(w, "passkeys.html", map[string]interface{}{
+		"Credentials": credentials,
+	})
+}
+
+// BeginAddCredential starts registering another passkey for the signed-in
+// user. Passkeys they already have are excluded, so an authenticator that
+// holds one of them refuses to create a duplicate.
+func (h *CredentialsHandler) BeginAddCredential(w http.ResponseWriter, r *http.Request) {
+	sess, userID, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	nickname, ok := parseNickname(w, r.FormValue("nickname"))
+	if !ok {
+		return
+	}
+
+	user, err := models.LoadUser(h.DB, userID)
+	if err != nil {
+		log.Printf("Error loading user ID %d: %v", userID, err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	options, session, err := h.WebAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.Credentials).CredentialDescriptors()))
+	if err != nil {
+		log.Printf("Error beginning passkey registration for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to begin registration", http.StatusInternalServerError)
+		return
+	}
+
+	sessionData, _ := json.Marshal(session)
+	sess.Values["addCredential"] = sessionData
+	sess.Values["credentialNickname"] = nickname
+	sess.Save(r, w)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+func (h *CredentialsHandler) FinishAddCredential(w http.ResponseWriter, r *http.Request) {
+	sess, userID, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessionData, ok := sess.Values["addCredential"].([]byte)
+	if !ok {
+		http.Error(w, "No registration in progress", http.StatusBadRequest)
+		return
+	}
+	nickname, _ := sess.Values["credentialNickname"].(string)
+
+	var sessionDataStruct webauthn.SessionData
+	if err := json.Unmarshal(sessionData, &sessionDataStruct); err != nil {
+		http.Error(w, "Invalid session data", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := models.LoadUser(h.DB, userID)
+	if err != nil {
+		log.Printf("Error loading user ID %d: %v", userID, err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	credential, err := h.WebAuthn.FinishRegistration(user, sessionDataStruct, r)
+	if err != nil {
+		log.Printf("Error finishing passkey registration for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to finish registration", http.StatusBadRequest)
+		return
+	}
+
+	if !checkAttestation(w, h.Attestation, fmt.Sprintf("user ID %d", userID), credential) {
+		return
+	}
+
+	if err := h.DB.SaveCredential(userID, credential.ID, credential.PublicKey, credential.Authenticator.AAGUID, credential.AttestationType, nickname, credential.Flags.BackupEligible, credential.Flags.BackupState, time.Now().Unix()); err != nil {
+		log.Printf("Error saving credential for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to save passkey", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Passkey added for user ID %d from IP: %s", userID, r.RemoteAddr)
+
+	delete(sess.Values, "addCredential")
+	delete(sess.Values, "credentialNickname")
+	sess.Save(r, w)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (h *CredentialsHandler) RenameCredential(w http.ResponseWriter, r *http.Request) {
+	_, userID, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid passkey ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		Nickname string `json:"nickname"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	nickname, ok := parseNickname(w, requestData.Nickname)
+	if !ok {
+		return
+	}
+
+	err = h.DB.RenameCredential(userID, id, nickname)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Passkey not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error renaming passkey %d for user ID %d: %v", id, userID, err)
+		http.Error(w, "Failed to rename passkey", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"nickname": nickname,
+	})
+}
+
+// DeleteCredential removes one of the user's passkeys and signs out the
+// sessions that were opened with it. The last passkey cannot be removed.
+func (h *CredentialsHandler) DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	sess, userID, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid passkey ID", http.StatusBadRequest)
+		return
+	}
+
+	credentialID, err := h.DB.DeleteUserCredential(userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Passkey not found", http.StatusNotFound)
+		return
+	}
+	if err == db.ErrLastCredential {
+		http.Error(w, "You cannot delete your only passkey. Add another one first.", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting passkey %d for user ID %d: %v", id, userID, err)
+		http.Error(w, "Failed to delete passkey", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.DB.RevokeCredentialSessions(credentialID); err != nil {
+		log.Printf("Error revoking sessions of passkey %d: %v", id, err)
+	}
+
+	log.Printf("Passkey %d deleted by user ID %d from IP: %s", id, userID, r.RemoteAddr)
+
+	current, _ := sess.Values["credentialID"].(string)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "success",
+		"signed_out": credentialID == current,
+	})
+}
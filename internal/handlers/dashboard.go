@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"database/sql"
 	"door-control/internal/db"
+	"door-control/internal/models"
 	"html/template"
 	"log"
 	"net/http"
@@ -12,7 +14,7 @@ import (
 
 type DashboardHandler struct {
 	DB        *db.DB
-	Store     *sessions.CookieStore
+	Store     sessions.Store
 	Templates *template.Template
 }
 
@@ -38,6 +40,15 @@ func (h *DashboardHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	status, err := h.DB.GetUserStatus(userID)
+	if err != nil || (status != "active" && status != "pending") {
+		log.Printf("Dashboard access denied: user ID %d is not active", userID)
+		sess.Options.MaxAge = -1
+		sess.Save(r, w)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
 	log.Printf("Dashboard accessed by user ID: %d from IP: %s", userID, r.RemoteAddr)
 
 	_, displayName, err := h.DB.GetUserByID(userID)
@@ -46,6 +57,11 @@ func (h *DashboardHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 		displayName = "User"
 	}
 
+	role, err := h.DB.GetUserRole(userID)
+	if err != nil {
+		log.Printf("Error getting role: %v", err)
+	}
+
 	bookings, err := h.DB.GetUserBookings(userID)
 	if err != nil {
 		log.Printf("Error getting bookings: %v", err)
@@ -56,12 +72,37 @@ func (h *DashboardHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 	activeBooking, err := h.DB.GetActiveBooking(userID, currentTime)
 	hasActiveBooking := err == nil && activeBooking != nil
 
+	unlockableDoors, err := h.DB.GetUnlockableDoors(userID, currentTime)
+	if err != nil {
+		log.Printf("Error getting unlockable doors: %v", err)
+	}
+
+	hasCalendarFeed, err := h.DB.HasCalendarToken(userID)
+	if err != nil {
+		log.Printf("Error checking calendar token: %v", err)
+	}
+
+	credentialFlag, err := h.DB.GetCredentialFlag(sessionCredential(sess))
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error checking credential flag for user ID %d: %v", userID, err)
+	}
+	credentialNotice := ""
+	if credentialFlag != "" {
+		credentialNotice = cloneFlagMessage(credentialFlag)
+	}
+
 	data := map[string]interface{}{
 		"UserID":           userID,
 		"DisplayName":      displayName,
+		"Role":             role,
+		"Pending":          status == "pending",
+		"CanAdmin":         models.Role(role).Can(models.PermViewUsers),
 		"Bookings":         bookings,
 		"HasActiveBooking": hasActiveBooking,
 		"ActiveBooking":    activeBooking,
+		"UnlockableDoors":  unlockableDoors,
+		"HasCalendarFeed":  hasCalendarFeed,
+		"CredentialNotice": credentialNotice,
 	}
 
 	h.Templates.ExecuteTemplate(w, "dashboard.html", data)
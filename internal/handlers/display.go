@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"door-control/internal/db"
+	"door-control/internal/presence"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const qrSize = 512
+
+// displayPath is the display link of a door. The token is only known to
+// the tablet it was set up on, and admins can replace it at any time.
+func displayPath(doorID int64, token string) string {
+	return fmt.Sprintf("/door/%d/display?key=%s", doorID, url.QueryEscape(token))
+}
+
+func (h *BookingHandler) displayDoor(w http.ResponseWriter, r *http.Request) (db.Door, bool) {
+	doorID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	token := r.URL.Query().Get("key")
+	if err != nil || token == "" {
+		http.Error(w, "Invalid display link", http.StatusNotFound)
+		return db.Door{}, false
+	}
+	door, err := h.DB.GetDoorByDisplayToken(doorID, token)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid display link", http.StatusNotFound)
+		return db.Door{}, false
+	}
+	if err != nil {
+		log.Printf("Error loading door %d: %v", doorID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return db.Door{}, false
+	}
+	return door, true
+}
+
+// scanOrigin picks the origin the QR code points to: the one the display
+// was opened on if passkeys work there, otherwise the first RP origin.
+func (h *BookingHandler) scanOrigin(r *http.Request) string {
+	origins := h.WebAuthn.Config.RPOrigins
+	for _, origin := range origins {
+		if origin == "https://"+r.Host || origin == "http://"+r.Host {
+			return origin
+		}
+	}
+	if len(origins) > 0 {
+		return origins[0]
+	}
+	return "https://" + r.Host
+}
+
+// DoorDisplay is the page shown on a tablet next to the door. It shows the
+// door's current code as a QR code that members scan to unlock.
+func (h *BookingHandler) DoorDisplay(w http.ResponseWriter, r *http.Request) {
+	door, ok := h.displayDoor(w, r)
+	if !ok {
+		return
+	}
+	h.Templates.ExecuteTemplate(w, "door_display.html", map[string]interface{}{
+		"Door":     door,
+		"CodePath": fmt.Sprintf("/door/%d/display/code?key=%s", door.ID, url.QueryEscape(r.URL.Query().Get("key"))),
+	})
+}
+
+// DoorDisplayCode returns the QR code for the current period as a PNG data
+// URL, and when the display should fetch the next one.
+func (h *BookingHandler) DoorDisplayCode(w http.ResponseWriter, r *http.Request) {
+	door, ok := h.displayDoor(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	code := presence.Code(presence.DoorKey(h.PresenceSecret, door.ID), now)
+	scanURL := fmt.Sprintf("%s/door/%d/scan?code=%s", h.scanOrigin(r), door.ID, code)
+	png, err := qrcode.Encode(scanURL, qrcode.Medium, qrSize)
+	if err != nil {
+		log.Printf("Error rendering QR code for door %s: %v", door.Name, err)
+		http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"qr":         "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		"expires_at": presence.Expires(now).Unix(),
+		"now":        now.Unix(),
+	})
+}
+
+// DoorScan is where the QR code leads. Members are sent to the dashboard
+// with the code; everyone else gets a page that forwards guests to their
+// guest link.
+func (h *BookingHandler) DoorScan(w http.ResponseWriter, r *http.Request) {
+	doorID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Unknown door", http.StatusNotFound)
+		return
+	}
+	query := url.Values{
+		"door": {strconv.FormatInt(doorID, 10)},
+		"code": {r.URL.Query().Get("code")},
+	}.Encode()
+
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err == nil && sess.Values["authenticated"] == true {
+		http.Redirect(w, r, "/dashboard?"+query, http.StatusSeeOther)
+		return
+	}
+	h.Templates.ExecuteTemplate(w, "door_scan.html", map[string]interface{}{
+		"Query": query,
+	})
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"door-control/internal/db"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxGuestPasses       = 10
+	maxGuestNameLength   = 64
+	guestLinkPathPrefix  = "/guest/"
+	guestSignatureDomain = "guest-pass"
+)
+
+var errInvalidGuestLink = errors.New("invalid guest link")
+
+// guestToken is "<pass id>.<signature>". The signature is an HMAC over the
+// pass and its booking, so a link cannot be forged or moved to another
+// booking; revocation and the booking window are checked in the database.
+func (h *BookingHandler) guestToken(pass db.GuestPass) string {
+	return fmt.Sprintf("%d.%s", pass.ID, base64.RawURLEncoding.EncodeToString(h.guestSignature(pass)))
+}
+
+func (h *BookingHandler) guestSignature(pass db.GuestPass) []byte {
+	mac := hmac.New(sha256.New, h.GuestSecret)
+	fmt.Fprintf(mac, "%s:%d:%d:%d", guestSignatureDomain, pass.ID, pass.BookingID, pass.CreatedAt)
+	return mac.Sum(nil)
+}
+
+func (h *BookingHandler) guestPassFromToken(token string) (db.GuestPass, error) {
+	idPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return db.GuestPass{}, errInvalidGuestLink
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return db.GuestPass{}, errInvalidGuestLink
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil {
+		return db.GuestPass{}, errInvalidGuestLink
+	}
+
+	pass, err := h.DB.GetGuestPass(id)
+	if err == sql.ErrNoRows {
+		return db.GuestPass{}, errInvalidGuestLink
+	}
+	if err != nil {
+		return db.GuestPass{}, err
+	}
+	if !hmac.Equal(sig, h.guestSignature(pass)) {
+		return db.GuestPass{}, errInvalidGuestLink
+	}
+	return pass, nil
+}
+
+// guestPassDenial returns why the pass cannot open doors right now, or "".
+func (h *BookingHandler) guestPassDenial(pass db.GuestPass, now int64) string {
+	switch {
+	case pass.RevokedAt != 0:
+		return "guest_pass_revoked"
+	case pass.BookingStatus != "active":
+		return "booking_cancelled"
+	case now < pass.StartTime:
+		return "booking_not_started"
+	case now > pass.EndTime:
+		return "booking_ended"
+	}
+	if status, err := h.DB.GetUserStatus(pass.HostUserID); err != nil || status != "active" {
+		return "host_inactive"
+	}
+	return ""
+}
+
+func guestDenialMessage(reason string) string {
+	switch reason {
+	case "booking_not_started":
+		return "This guest link is not valid yet. It works during the booking."
+	case "booking_ended":
+		return "This guest link has expired."
+	}
+	return "This guest link is no longer valid. Please ask your host for a new one."
+}
+
+// guestDoors leaves out the doors a guest cannot open: those that need a
+// step-up with a passkey.
+func guestDoors(doors []db.Door) []db.Door {
+	var open []db.Door
+	for _, d := range doors {
+		if !d.StepUp {
+			open = append(open, d)
+		}
+	}
+	return open
+}
+
+func (h *BookingHandler) guestPassJSON(pass db.GuestPass) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           pass.ID,
+		"guest_name":   pass.GuestName,
+		"created_at":   pass.CreatedAt,
+		"revoked_at":   pass.RevokedAt,
+		"last_used_at": pass.LastUsedAt,
+		"path":         guestLinkPathPrefix + h.guestToken(pass),
+	}
+}
+
+// CreateGuestPass creates a guest link for one of the member's bookings.
+func (h *BookingHandler) CreateGuestPass(w http.ResponseWriter, r *http.Request) {
+	userID, booking, ok := h.ownedBooking(w, r)
+	if !ok {
+		return
+	}
+	bookingID := booking["id"].(int64)
+
+	if booking["status"] != "active" || booking["end_time"].(int64) <= time.Now().Unix() {
+		http.Error(w, "Guest links can only be created for upcoming or current bookings", http.StatusConflict)
+		return
+	}
+
+	var requestData struct {
+		GuestName string `json:"guest_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request data", http.StatusBadRequest)
+		return
+	}
+	guestName := strings.TrimSpace(requestData.GuestName)
+	if guestName == "" || len(guestName) > maxGuestNameLength {
+		http.Error(w, "Guest name required (at most 64 characters)", http.StatusBadRequest)
+		return
+	}
+
+	count, err := h.DB.CountBookingGuestPasses(bookingID)
+	if err != nil {
+		log.Printf("Error counting guest passes of booking %d: %v", bookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxGuestPasses {
+		http.Error(w, fmt.Sprintf("A booking can have at most %d guest links", maxGuestPasses), http.StatusConflict)
+		return
+	}
+
+	id, err := h.DB.CreateGuestPass(bookingID, guestName, userID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Error creating guest pass for booking %d: %v", bookingID, err)
+		http.Error(w, "Failed to create guest link", http.StatusInternalServerError)
+		return
+	}
+	pass, err := h.DB.GetGuestPass(id)
+	if err != nil {
+		log.Printf("Error loading guest pass %d: %v", id, err)
+		http.Error(w, "Failed to create guest link", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Guest pass %d for %s created on booking %d by user ID %d", id, guestName, bookingID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.guestPassJSON(pass))
+}
+
+func (h *BookingHandler) ListGuestPasses(w http.ResponseWriter, r *http.Request) {
+	_, booking, ok := h.ownedBooking(w, r)
+	if !ok {
+		return
+	}
+	bookingID := booking["id"].(int64)
+
+	passes, err := h.DB.ListBookingGuestPasses(bookingID)
+	if err != nil {
+		log.Printf("Error listing guest passes of booking %d: %v", bookingID, err)
+		http.Error(w, "Failed to list guest links", http.StatusInternalServerError)
+		return
+	}
+
+	list := []map[string]interface{}{}
+	for _, pass := range passes {
+		list = append(list, h.guestPassJSON(pass))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *BookingHandler) RevokeGuestPass(w http.ResponseWriter, r *http.Request) {
+	userID, booking, ok := h.ownedBooking(w, r)
+	if !ok {
+		return
+	}
+	bookingID := booking["id"].(int64)
+
+	passID, err := strconv.ParseInt(r.PathValue("guest"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid guest link ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.DB.RevokeGuestPass(bookingID, passID, time.Now().Unix())
+	if err == sql.ErrNoRows {
+		http.Error(w, "Guest link not found or already revoked", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking guest pass %d: %v", passID, err)
+		http.Error(w, "Failed to revoke guest link", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Guest pass %d on booking %d revoked by user ID %d", passID, bookingID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// GuestPage is the page a guest opens from their link.
+func (h *BookingHandler) GuestPage(w http.ResponseWriter, r *http.Request) {
+	pass, err := h.guestPassFromToken(r.PathValue("token"))
+	if err != nil {
+		if err != errInvalidGuestLink {
+			log.Printf("Error loading guest pass: %v", err)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		h.Templates.ExecuteTemplate(w, "guest.html", map[string]interface{}{
+			"Message": guestDenialMessage(""),
+		})
+		return
+	}
+
+	data := map[string]interface{}{
+		"Pass": pass,
+	}
+	if reason := h.guestPassDenial(pass, time.Now().Unix()); reason != "" && reason != "booking_not_started" {
+		data["Message"] = guestDenialMessage(reason)
+	} else {
+		doors, err := h.DB.GetBookingDoors(pass.BookingID)
+		if err != nil {
+			log.Printf("Error loading doors of booking %d: %v", pass.BookingID, err)
+		}
+		data["Doors"] = guestDoors(doors)
+	}
+	h.Templates.ExecuteTemplate(w, "guest.html", data)
+}
+
+// GuestUnlock opens a door for a guest. The same presence checks apply as for
+// members; the event is recorded as guest_unlock under the host.
+func (h *BookingHandler) GuestUnlock(w http.ResponseWriter, r *http.Request) {
+	event := db.AccessEvent{Type: db.EventGuestUnlock}
+
+	pass, err := h.guestPassFromToken(r.PathValue("token"))
+	if err != nil {
+		if err != errInvalidGuestLink {
+			log.Printf("Error loading guest pass: %v", err)
+		}
+		log.Printf("Guest unlock denied: invalid link from IP: %s", r.RemoteAddr)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "invalid_guest_link")
+		writeUnlockError(w, http.StatusNotFound, "invalid_guest_link", map[string]interface{}{
+			"message": guestDenialMessage(""),
+		})
+		return
+	}
+	event.UserID = pass.HostUserID
+	event.BookingID = pass.BookingID
+	event.Details = fmt.Sprintf("guest %s (link %d)", pass.GuestName, pass.ID)
+
+	var requestData struct {
+		presenceClaim
+		DoorID int64 `json:"door_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "invalid_request")
+		http.Error(w, "Invalid request data", http.StatusBadRequest)
+		return
+	}
+	event.DoorID = requestData.DoorID
+
+	now := time.Now().Unix()
+	if reason := h.guestPassDenial(pass, now); reason != "" {
+		log.Printf("Guest unlock denied for link %d: %s", pass.ID, reason)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, reason)
+		writeUnlockError(w, http.StatusForbidden, reason, map[string]interface{}{
+			"message": guestDenialMessage(reason),
+		})
+		return
+	}
+
+	doors, err := h.DB.GetBookingDoors(pass.BookingID)
+	if err != nil {
+		log.Printf("Error loading doors of booking %d: %v", pass.BookingID, err)
+		recordAccess(h.DB, r, event, db.OutcomeError, "database_error")
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	var door db.Door
+	for _, d := range doors {
+		if d.ID == requestData.DoorID {
+			door = d
+		}
+	}
+	if door.ID == 0 {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "door_not_in_booking")
+		writeUnlockError(w, http.StatusForbidden, "door_not_in_booking", map[string]interface{}{
+			"message": "This guest link does not open that door.",
+		})
+		return
+	}
+	// Step-up doors need a passkey assertion, which guests do not have.
+	if door.StepUp {
+		log.Printf("Guest unlock denied for link %d: door ID %d requires step-up", pass.ID, door.ID)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "step_up_guest")
+		writeUnlockError(w, http.StatusForbidden, "step_up_guest", map[string]interface{}{
+			"message": "This door needs a passkey and cannot be opened with a guest link. Please ask your host to let you in.",
+		})
+		return
+	}
+
+	if err := h.DB.TouchGuestPass(pass.ID, now); err != nil {
+		log.Printf("Error updating guest pass %d: %v", pass.ID, err)
+	}
+
+	log.Printf("Guest unlock attempt with link %d (%s) for door ID: %d from IP: %s", pass.ID, pass.GuestName, door.ID, r.RemoteAddr)
+	h.openDoor(w, r, event, door, requestData.presenceClaim, fmt.Sprintf("guest:%d", pass.ID), fmt.Sprintf("guest %s (link %d)", pass.GuestName, pass.ID))
+}
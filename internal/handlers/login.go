@@ -3,11 +3,14 @@ package handlers
 import (
 	"door-control/internal/db"
 	"door-control/internal/models"
+	"encoding/base64"
 	"encoding/json"
 	"html/template"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gorilla/sessions"
 )
@@ -15,7 +18,7 @@ import (
 type LoginHandler struct {
 	DB        *db.DB
 	WebAuthn  *webauthn.WebAuthn
-	Store     *sessions.CookieStore
+	Store     sessions.Store
 	Templates *template.Template
 }
 
@@ -35,30 +38,28 @@ func (h *LoginHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, displayName, err := h.DB.GetUserByUsername(username)
+	userID, _, err := h.DB.GetUserByUsername(username)
 	if err != nil {
 		log.Printf("Login failed: user %s not found from IP: %s - %v", username, r.RemoteAddr, err)
+		recordAccess(h.DB, r, db.AccessEvent{Type: db.EventLogin, Username: username}, db.OutcomeDenied, "unknown_user")
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
+	if !accountCanSignIn(w, h.DB, userID) {
+		recordAccess(h.DB, r, db.AccessEvent{Type: db.EventLogin, UserID: userID}, db.OutcomeDenied, "account_inactive")
+		return
+	}
+
 	log.Printf("User %s (ID: %d) found, beginning WebAuthn authentication", username, userID)
 
-	credentials, err := models.LoadUserCredentials(h.DB, userID)
+	user, err := models.LoadUser(h.DB, userID)
 	if err != nil {
 		log.Printf("Error loading credentials: %v", err)
 		http.Error(w, "Failed to load credentials", http.StatusInternalServerError)
 		return
 	}
 
-	user := models.User{
-		ID:          userID,
-		Username:    username,
-		DisplayName: displayName,
-		Credentials: credentials,
-		DB:          h.DB,
-	}
-
 	options, session, err := h.WebAuthn.BeginLogin(user)
 	if err != nil {
 		log.Printf("Error beginning login: %v", err)
@@ -101,62 +102,168 @@ func (h *LoginHandler) FinishLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, displayName, err := h.DB.GetUserByUsername(string(sessionDataStruct.UserID))
-	if err != nil {
+	// The challenge was issued for the user handle, which must still belong
+	// to the user the login was started for.
+	handleUserID, _, _, err := h.DB.GetUserByHandle(sessionDataStruct.UserID)
+	if err != nil || handleUserID != userID {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	credentials, err := models.LoadUserCredentials(h.DB, userID)
-	if err != nil {
-		http.Error(w, "Failed to load credentials", http.StatusInternalServerError)
+	event := db.AccessEvent{Type: db.EventLogin, UserID: userID}
+
+	if !accountCanSignIn(w, h.DB, userID) {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "account_inactive")
 		return
 	}
 
-	user := models.User{
-		ID:          userID,
-		Username:    string(sessionDataStruct.UserID),
-		DisplayName: displayName,
-		Credentials: credentials,
-		DB:          h.DB,
+	user, err := models.LoadUser(h.DB, userID)
+	if err != nil {
+		http.Error(w, "Failed to load credentials", http.StatusInternalServerError)
+		return
 	}
 
 	credential, err := h.WebAuthn.FinishLogin(user, sessionDataStruct, r)
 	if err != nil {
 		log.Printf("Login failed for user ID %d: WebAuthn authentication error - %v", userID, err)
+		event.Details = err.Error()
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "assertion_failed")
 		http.Error(w, "Failed to finish login", http.StatusInternalServerError)
 		return
 	}
 
+	delete(sess.Values, "authentication")
+	h.completeLogin(w, r, sess, event, user.Username, credential)
+}
+
+// completeLogin records a successful assertion and signs the session in.
+func (h *LoginHandler) completeLogin(w http.ResponseWriter, r *http.Request, sess *sessions.Session, event db.AccessEvent, username string, credential *webauthn.Credential) {
+	userID := event.UserID
+
+	event.CredentialID = base64.RawURLEncoding.EncodeToString(credential.ID)
 	if credential.Authenticator.CloneWarning {
-		log.Printf("WARNING: Clone detected for credential ID: %x (User ID: %d)", credential.ID, userID)
+		handleCloneWarning(h.DB, r, &event, credential)
+	}
+
+	flag, err := h.DB.GetCredentialFlag(event.CredentialID)
+	if err != nil {
+		log.Printf("Error checking credential flag for user ID %d: %v", userID, err)
+	}
+	if flag == db.CloneFlagSuspended {
+		log.Printf("Login denied for user ID %d: credential %s is suspended", userID, event.CredentialID)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "credential_suspended")
+		http.Error(w, cloneFlagMessage(flag), http.StatusForbidden)
+		return
 	}
 
-	if err := h.DB.UpdateSignCount(credential.ID, int(credential.Authenticator.SignCount)); err != nil {
+	if err := h.DB.UpdateSignCount(credential.ID, int(credential.Authenticator.SignCount), time.Now().Unix()); err != nil {
 		log.Printf("Error updating sign count for user ID %d: %v", userID, err)
 	}
 
-	log.Printf("Login successful for user ID %d (%s) from IP: %s", userID, string(sessionDataStruct.UserID), r.RemoteAddr)
+	log.Printf("Login successful for user ID %d (%s) from IP: %s", userID, username, r.RemoteAddr)
+	recordAccess(h.DB, r, event, db.OutcomeAllowed, "")
 
-	delete(sess.Values, "authentication")
-	sess.Values["authenticated"] = true
-	sess.Values["userID"] = userID
-	sess.Values["username"] = string(sessionDataStruct.UserID)
-	sess.Save(r, w)
+	if err := signIn(h.DB, w, r, sess, userID, username, event.CredentialID); err != nil {
+		log.Printf("Error saving session for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
+// BeginDiscoverableLogin starts a login without a username. The browser
+// offers the passkeys it has for this site and the user is identified by
+// the passkey's user handle. With conditional=1 the request is meant for
+// autofill and stays pending until a passkey is picked.
+func (h *LoginHandler) BeginDiscoverableLogin(w http.ResponseWriter, r *http.Request) {
+	mediation := protocol.MediationDefault
+	if r.FormValue("conditional") == "1" {
+		mediation = protocol.MediationConditional
+	}
+
+	options, session, err := h.WebAuthn.BeginDiscoverableMediatedLogin(mediation)
+	if err != nil {
+		log.Printf("Error beginning passkey login: %v", err)
+		http.Error(w, "Failed to begin login", http.StatusInternalServerError)
+		return
+	}
+
+	sess, _ := h.Store.Get(r, "webauthn-session")
+	sessionData, _ := json.Marshal(session)
+	sess.Values["passkeyAuthentication"] = sessionData
+	sess.Save(r, w)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+func (h *LoginHandler) FinishDiscoverableLogin(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil {
+		http.Error(w, "Session error", http.StatusInternalServerError)
+		return
+	}
+
+	sessionData, ok := sess.Values["passkeyAuthentication"].([]byte)
+	if !ok {
+		http.Error(w, "No authentication in progress", http.StatusBadRequest)
+		return
+	}
+
+	var sessionDataStruct webauthn.SessionData
+	if err := json.Unmarshal(sessionData, &sessionDataStruct); err != nil {
+		http.Error(w, "Invalid session data", http.StatusInternalServerError)
+		return
+	}
+
+	event := db.AccessEvent{Type: db.EventLogin}
+	var user models.User
+
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, _, _, err := h.DB.GetUserByHandle(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		event.UserID = userID
+
+		user, err = models.LoadUser(h.DB, userID)
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	_, credential, err := h.WebAuthn.FinishPasskeyLogin(findUser, sessionDataStruct, r)
+	if err != nil {
+		log.Printf("Passkey login failed from IP: %s - %v", r.RemoteAddr, err)
+		reason := "assertion_failed"
+		if event.UserID == 0 {
+			reason = "unknown_user"
+		}
+		event.Details = err.Error()
+		recordAccess(h.DB, r, event, db.OutcomeDenied, reason)
+		http.Error(w, "Failed to finish login", http.StatusUnauthorized)
+		return
+	}
+
+	if !accountCanSignIn(w, h.DB, event.UserID) {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "account_inactive")
+		return
+	}
+
+	delete(sess.Values, "passkeyAuthentication")
+	h.completeLogin(w, r, sess, event, user.Username, credential)
+}
+
 func (h *LoginHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	sess, _ := h.Store.Get(r, "webauthn-session")
 	userID, _ := sess.Values["userID"].(int64)
 
 	log.Printf("User logged out - User ID: %d, IP: %s", userID, r.RemoteAddr)
 
-	sess.Values["authenticated"] = false
-	delete(sess.Values, "userID")
-	delete(sess.Values, "username")
+	sess.Options.MaxAge = -1
 	sess.Save(r, w)
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// unlockNonceTTL is how long an unlock nonce can be used.
+const unlockNonceTTL = time.Minute
+
+func hashUnlockNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// UnlockChallenge issues a single-use nonce that the next /unlock request
+// must carry, so a captured unlock request cannot be replayed.
+func (h *BookingHandler) UnlockChallenge(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+	if !accountActive(w, h.DB, userID) {
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		log.Printf("Error generating unlock nonce: %v", err)
+		http.Error(w, "Failed to create challenge", http.StatusInternalServerError)
+		return
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	expiresAt := now.Add(unlockNonceTTL).Unix()
+	if err := h.DB.CreateUnlockNonce(hashUnlockNonce(nonce), userID, now.Unix(), expiresAt); err != nil {
+		log.Printf("Error storing unlock nonce for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to create challenge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"nonce":      nonce,
+		"expires_at": expiresAt,
+	})
+}
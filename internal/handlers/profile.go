@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"door-control/internal/db"
+	"door-control/internal/models"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	maxUsernameLength    = 64
+	maxDisplayNameLength = 100
+)
+
+type ProfileHandler struct {
+	DB        *db.DB
+	Store     sessions.Store
+	Templates *template.Template
+}
+
+func (h *ProfileHandler) ProfilePage(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	username, displayName, err := h.DB.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user ID %d: %v", userID, err)
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+
+	recoveryCodes, err := h.DB.CountRecoveryCodes(userID)
+	if err != nil {
+		log.Printf("Error counting recovery codes of user ID %d: %v", userID, err)
+	}
+
+	h.Templates.ExecuteTemplate(w, "profile.html", map[string]interface{}{
+		"Username":      username,
+		"DisplayName":   displayName,
+		"RecoveryCodes": recoveryCodes,
+	})
+}
+
+// UpdateProfile changes the signed-in user's username and display name.
+// Passkeys keep working because they are bound to the user handle.
+func (h *ProfileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	if !accountCanSignIn(w, h.DB, userID) {
+		return
+	}
+
+	var requestData struct {
+		Username    string `json:"username"`
+		DisplayName string `json:"display_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	username := strings.TrimSpace(requestData.Username)
+	displayName := strings.TrimSpace(requestData.DisplayName)
+	if username == "" || displayName == "" {
+		http.Error(w, "Username and display name required", http.StatusBadRequest)
+		return
+	}
+	if len(username) > maxUsernameLength || len(displayName) > maxDisplayNameLength {
+		http.Error(w, "Username or display name is too long", http.StatusBadRequest)
+		return
+	}
+
+	oldUsername, _, err := h.DB.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error getting user ID %d: %v", userID, err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	// Usernames in ADMIN_USERNAMES are promoted on startup, so they cannot
+	// be claimed by renaming an account.
+	if username != oldUsername && isBootstrapAdmin(username) {
+		role, err := h.DB.GetUserRole(userID)
+		if err != nil || models.Role(role) != models.RoleAdmin {
+			http.Error(w, "Username is already taken", http.StatusConflict)
+			return
+		}
+	}
+
+	err = h.DB.UpdateUserProfile(userID, username, displayName)
+	if err == db.ErrUsernameTaken {
+		http.Error(w, "Username is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating profile of user ID %d: %v", userID, err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	if username != oldUsername {
+		log.Printf("User ID %d renamed from %s to %s", userID, oldUsername, username)
+	}
+
+	sess.Values["username"] = username
+	sess.Save(r, w)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "success",
+		"username":     username,
+		"display_name": displayName,
+	})
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"door-control/internal/attestation"
+	"door-control/internal/db"
+	"door-control/internal/models"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/sessions"
+)
+
+const recoveryCodeCount = 10
+
+// hashRecoveryCode normalises a code as typed by the user and hashes it.
+// Codes carry 80 random bits, so a plain SHA-256 is enough to store them.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueRecoveryCodes replaces the user's recovery codes with a new set and
+// returns the codes in plain text. They are not stored and can only be
+// shown once.
+func issueRecoveryCodes(database *db.DB, userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = fmt.Sprintf("%s-%s-%s-%s", s[0:4], s[4:8], s[8:12], s[12:16])
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	if err := database.ReplaceRecoveryCodes(userID, hashes, time.Now().Unix()); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RecoveryHandler lets members who lost their passkeys sign in with a
+// recovery code and register a new passkey.
+type RecoveryHandler struct {
+	DB          *db.DB
+	WebAuthn    *webauthn.WebAuthn
+	Store       sessions.Store
+	Templates   *template.Template
+	Attestation *attestation.Policy
+}
+
+func (h *RecoveryHandler) RecoverPage(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Recovery page accessed from IP: %s", r.RemoteAddr)
+	h.Templates.ExecuteTemplate(w, "recover.html", nil)
+}
+
+// BeginRecovery checks a recovery code and starts registering a new
+// passkey. The code is used up even if the registration is not completed.
+func (h *RecoveryHandler) BeginRecovery(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimSpace(r.FormValue("username"))
+	code := r.FormValue("code")
+
+	log.Printf("Recovery attempt for username: %s from IP: %s", username, r.RemoteAddr)
+
+	if username == "" || code == "" {
+		http.Error(w, "Username and recovery code required", http.StatusBadRequest)
+		return
+	}
+
+	event := db.AccessEvent{Type: db.EventRecovery, Username: username}
+
+	userID, _, err := h.DB.GetUserByUsername(username)
+	if err != nil {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "unknown_user")
+		http.Error(w, "Invalid username or recovery code", http.StatusUnauthorized)
+		return
+	}
+	event.UserID = userID
+	event.Username = ""
+
+	if !accountCanSignIn(w, h.DB, userID) {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "account_inactive")
+		return
+	}
+
+	err = h.DB.UseRecoveryCode(userID, hashRecoveryCode(code), time.Now().Unix())
+	if err == sql.ErrNoRows {
+		log.Printf("Recovery failed for user ID %d: invalid code from IP: %s", userID, r.RemoteAddr)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "invalid_code")
+		http.Error(w, "Invalid username or recovery code", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error using recovery code for user ID %d: %v", userID, err)
+		recordAccess(h.DB, r, event, db.OutcomeError, "database_error")
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	remaining, _ := h.DB.CountRecoveryCodes(userID)
+	event.Details = fmt.Sprintf("recovery code used, %d left", remaining)
+	recordAccess(h.DB, r, event, db.OutcomeAllowed, "")
+
+	user, err := models.LoadUser(h.DB, userID)
+	if err != nil {
+		log.Printf("Error loading user ID %d: %v", userID, err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	options, session, err := h.WebAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.Credentials).CredentialDescriptors()))
+	if err != nil {
+		log.Printf("Error beginning recovery registration for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to begin registration", http.StatusInternalServerError)
+		return
+	}
+
+	sess, _ := h.Store.Get(r, "webauthn-session")
+	sessionData, _ := json.Marshal(session)
+	sess.Values["recovery"] = sessionData
+	sess.Values["recoveryUserID"] = userID
+	sess.Save(r, w)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+// FinishRecovery saves the new passkey and signs the user in. All other
+// sessions are signed out, since a lost device may still be logged in.
+func (h *RecoveryHandler) FinishRecovery(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil {
+		http.Error(w, "Session error", http.StatusInternalServerError)
+		return
+	}
+
+	sessionData, ok := sess.Values["recovery"].([]byte)
+	if !ok {
+		http.Error(w, "No recovery in progress", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := sess.Values["recoveryUserID"].(int64)
+	if !ok {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	var sessionDataStruct webauthn.SessionData
+	if err := json.Unmarshal(sessionData, &sessionDataStruct); err != nil {
+		http.Error(w, "Invalid session data", http.StatusInternalServerError)
+		return
+	}
+
+	event := db.AccessEvent{Type: db.EventRecovery, UserID: userID}
+
+	if !accountCanSignIn(w, h.DB, userID) {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "account_inactive")
+		return
+	}
+
+	user, err := models.LoadUser(h.DB, userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	credential, err := h.WebAuthn.FinishRegistration(user, sessionDataStruct, r)
+	if err != nil {
+		log.Printf("Error finishing recovery registration for user ID %d: %v", userID, err)
+		event.Details = err.Error()
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "registration_failed")
+		http.Error(w, "Failed to finish registration", http.StatusBadRequest)
+		return
+	}
+
+	if !checkAttestation(w, h.Attestation, fmt.Sprintf("user ID %d", userID), credential) {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "authenticator_not_allowed")
+		return
+	}
+
+	if err := h.DB.SaveCredential(userID, credential.ID, credential.PublicKey, credential.Authenticator.AAGUID, credential.AttestationType, "", credential.Flags.BackupEligible, credential.Flags.BackupState, time.Now().Unix()); err != nil {
+		log.Printf("Error saving credential for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to save passkey", http.StatusInternalServerError)
+		return
+	}
+
+	if n, err := h.DB.RevokeUserSessions(userID, ""); err != nil {
+		log.Printf("Error revoking sessions of user ID %d: %v", userID, err)
+	} else if n > 0 {
+		log.Printf("Signed out %d sessions of user ID %d after recovery", n, userID)
+	}
+
+	log.Printf("Account recovered for user ID %d from IP: %s", userID, r.RemoteAddr)
+	event.CredentialID = base64.RawURLEncoding.EncodeToString(credential.ID)
+	event.Details = "passkey enrolled"
+	recordAccess(h.DB, r, event, db.OutcomeAllowed, "")
+
+	delete(sess.Values, "recovery")
+	delete(sess.Values, "recoveryUserID")
+	if err := signIn(h.DB, w, r, sess, userID, user.Username, event.CredentialID); err != nil {
+		log.Printf("Error saving session for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	remaining, _ := h.DB.CountRecoveryCodes(userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":                   "success",
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// BeginRegenerateCodes returns WebAuthn assertion options for confirming a
+// new set of recovery codes, so a signed-in session alone cannot replace
+// them.
+func (h *RecoveryHandler) BeginRegenerateCodes(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	if !accountCanSignIn(w, h.DB, userID) {
+		return
+	}
+
+	options, err := beginStepUp(h.DB, h.WebAuthn, sess, "recoveryCodesStepUp", userID, stepUpRecoveryCodes, time.Now())
+	if err != nil {
+		log.Printf("Error beginning recovery code step-up for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to begin confirmation", http.StatusInternalServerError)
+		return
+	}
+
+	if err := sess.Save(r, w); err != nil {
+		log.Printf("Error saving session for user ID %d: %v", userID, err)
+		http.Error(w, "Session error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+// RegenerateCodes replaces the signed-in user's recovery codes once they
+// confirm with a passkey and user verification.
+func (h *RecoveryHandler) RegenerateCodes(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	if !accountCanSignIn(w, h.DB, userID) {
+		return
+	}
+
+	var requestData struct {
+		Assertion json.RawMessage `json:"assertion"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request data", http.StatusBadRequest)
+		return
+	}
+
+	event := db.AccessEvent{Type: db.EventRecovery, UserID: userID}
+	credentialID, reason, message := verifyStepUp(h.DB, h.WebAuthn, r, sess, &event, "recoveryCodesStepUp", stepUpRecoveryCodes, requestData.Assertion, time.Now())
+	sess.Save(r, w)
+	if reason != "" {
+		log.Printf("Recovery code regeneration denied for user ID %d: %s", userID, reason)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, reason)
+		http.Error(w, message, http.StatusUnauthorized)
+		return
+	}
+	event.CredentialID = credentialID
+
+	codes, err := issueRecoveryCodes(h.DB, userID)
+	if err != nil {
+		log.Printf("Error creating recovery codes for user ID %d: %v", userID, err)
+		recordAccess(h.DB, r, event, db.OutcomeError, "database_error")
+		http.Error(w, "Failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Recovery codes regenerated by user ID %d from IP: %s", userID, r.RemoteAddr)
+	event.Details = "recovery codes replaced"
+	recordAccess(h.DB, r, event, db.OutcomeAllowed, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "success",
+		"recovery_codes": codes,
+	})
+}
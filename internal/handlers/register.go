@@ -1,13 +1,19 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"door-control/internal/attestation"
 	"door-control/internal/db"
 	"door-control/internal/models"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"html/template"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/go-webauthn/webauthn/webauthn"
@@ -15,20 +21,79 @@ import (
 )
 
 type RegisterHandler struct {
-	DB        *db.DB
-	WebAuthn  *webauthn.WebAuthn
-	Store     *sessions.CookieStore
-	Templates *template.Template
+	DB          *db.DB
+	WebAuthn    *webauthn.WebAuthn
+	Store       sessions.Store
+	Templates   *template.Template
+	Attestation *attestation.Policy
+}
+
+// RegistrationMode returns REGISTRATION_MODE: "open" lets anyone register,
+// "approval" lets anyone register but an admin has to approve the account,
+// and "invite" (the default) requires an invite from an admin.
+func RegistrationMode() string {
+	switch mode := os.Getenv("REGISTRATION_MODE"); mode {
+	case "open", "approval":
+		return mode
+	}
+	return "invite"
+}
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func (h *RegisterHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Registration page accessed from IP: %s", r.RemoteAddr)
-	h.Templates.ExecuteTemplate(w, "register.html", nil)
+
+	data := map[string]interface{}{
+		"InviteRequired": RegistrationMode() == "invite",
+		"NeedsApproval":  RegistrationMode() == "approval",
+	}
+	if token := r.URL.Query().Get("bootstrap"); token != "" {
+		data["Bootstrap"] = token
+	}
+	if token := r.URL.Query().Get("invite"); token != "" {
+		data["Invite"] = token
+		inv, err := h.DB.GetInviteByToken(hashInviteToken(token))
+		if err == nil && inv.Usable(time.Now().Unix()) {
+			data["DisplayName"] = inv.DisplayName
+		} else {
+			data["InviteInvalid"] = true
+		}
+	}
+	h.Templates.ExecuteTemplate(w, "register.html", data)
+}
+
+// pendingRegistration is kept in the session between BeginRegistration and
+// FinishRegistration. The user is only created, and the invite only used,
+// once the passkey has been registered.
+type pendingRegistration struct {
+	Username    string
+	DisplayName string
+	Handle      []byte
+	Role        string
+	Status      string
+	InviteHash  string
+	Bootstrap   bool
+}
+
+// bootstrapAllowed reports whether token is ADMIN_BOOTSTRAP_TOKEN and
+// username is in ADMIN_USERNAMES. It lets the first admin register on a
+// fresh installation without an invite, until an admin exists.
+func bootstrapAllowed(token, username string) bool {
+	expected := os.Getenv("ADMIN_BOOTSTRAP_TOKEN")
+	return expected != "" && token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 &&
+		isBootstrapAdmin(username)
 }
 
 func (h *RegisterHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	displayName := r.FormValue("displayName")
+	invite := r.FormValue("invite")
+	bootstrap := r.FormValue("bootstrap")
 
 	log.Printf("Registration attempt for username: %s from IP: %s", username, r.RemoteAddr)
 
@@ -38,32 +103,86 @@ func (h *RegisterHandler) BeginRegistration(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	userID, _, err := h.DB.GetUserByUsername(username)
+	_, _, err := h.DB.GetUserByUsername(username)
 	if err == nil {
 		log.Printf("Registration failed: user %s already exists from IP: %s", username, r.RemoteAddr)
 		http.Error(w, "User already exists", http.StatusConflict)
 		return
 	}
-
-	if err != nil && err != sql.ErrNoRows {
+	if err != sql.ErrNoRows {
 		log.Printf("Error checking user: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	userID, err = h.DB.CreateUser(username, displayName, time.Now().Unix())
-	if err != nil {
-		log.Printf("Error creating user %s: %v", username, err)
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+	pending := pendingRegistration{
+		Username:    username,
+		DisplayName: displayName,
+		Role:        string(models.RoleMember),
+	}
+	switch {
+	case invite != "":
+		inv, err := h.DB.GetInviteByToken(hashInviteToken(invite))
+		if err == sql.ErrNoRows || (err == nil && !inv.Usable(time.Now().Unix())) {
+			log.Printf("Registration failed: invalid invite for %s from IP: %s", username, r.RemoteAddr)
+			http.Error(w, "This invite is invalid, has expired or has already been used", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			log.Printf("Error checking invite: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if inv.DisplayName != "" {
+			pending.DisplayName = inv.DisplayName
+		}
+		pending.InviteHash = hashInviteToken(invite)
+		pending.Role = inv.Role
+		pending.Status = "active"
+	case bootstrap != "":
+		admins, err := h.DB.CountUsersWithRole(string(models.RoleAdmin))
+		if err != nil {
+			log.Printf("Error counting admins: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if admins > 0 || !bootstrapAllowed(bootstrap, username) {
+			log.Printf("Registration failed: bootstrap admin refused for %s from IP: %s", username, r.RemoteAddr)
+			http.Error(w, "This setup link is invalid or an admin already exists", http.StatusForbidden)
+			return
+		}
+		pending.Role = string(models.RoleAdmin)
+		pending.Status = "active"
+		pending.Bootstrap = true
+	case RegistrationMode() == "open":
+		pending.Status = "active"
+	case RegistrationMode() == "approval":
+		pending.Status = "pending"
+	default:
+		log.Printf("Registration failed: no invite for %s from IP: %s", username, r.RemoteAddr)
+		http.Error(w, "An invite is required to register", http.StatusForbidden)
 		return
 	}
 
-	log.Printf("User created successfully: %s (ID: %d)", username, userID)
+	// Usernames in ADMIN_USERNAMES are promoted on startup, so only the
+	// bootstrap link or an admin invite may claim them.
+	if isBootstrapAdmin(username) && pending.Role != string(models.RoleAdmin) {
+		log.Printf("Registration failed: %s is reserved for an admin, IP: %s", username, r.RemoteAddr)
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
+
+	pending.Handle, err = db.NewUserHandle()
+	if err != nil {
+		log.Printf("Error creating user handle for %s: %v", username, err)
+		http.Error(w, "Failed to begin registration", http.StatusInternalServerError)
+		return
+	}
 
 	user := models.User{
-		ID:          userID,
-		Username:    username,
-		DisplayName: displayName,
+		Handle:      pending.Handle,
+		Username:    pending.Username,
+		DisplayName: pending.DisplayName,
 		Credentials: []webauthn.Credential{},
 		DB:          h.DB,
 	}
@@ -77,8 +196,9 @@ func (h *RegisterHandler) BeginRegistration(w http.ResponseWriter, r *http.Reque
 
 	sess, _ := h.Store.Get(r, "webauthn-session")
 	sessionData, _ := json.Marshal(session)
+	pendingData, _ := json.Marshal(pending)
 	sess.Values["registration"] = sessionData
-	sess.Values["userID"] = userID
+	sess.Values["pendingRegistration"] = pendingData
 	sess.Save(r, w)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -98,8 +218,9 @@ func (h *RegisterHandler) FinishRegistration(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	userID, ok := sess.Values["userID"].(int64)
-	if !ok {
+	var pending pendingRegistration
+	pendingData, ok := sess.Values["pendingRegistration"].([]byte)
+	if !ok || json.Unmarshal(pendingData, &pending) != nil {
 		http.Error(w, "Invalid session", http.StatusBadRequest)
 		return
 	}
@@ -110,16 +231,10 @@ func (h *RegisterHandler) FinishRegistration(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	_, displayName, err := h.DB.GetUserByUsername(string(sessionDataStruct.UserID))
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
-	}
-
 	user := models.User{
-		ID:          userID,
-		Username:    string(sessionDataStruct.UserID),
-		DisplayName: displayName,
+		Handle:      pending.Handle,
+		Username:    pending.Username,
+		DisplayName: pending.DisplayName,
 		Credentials: []webauthn.Credential{},
 		DB:          h.DB,
 	}
@@ -131,20 +246,75 @@ func (h *RegisterHandler) FinishRegistration(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if err := h.DB.SaveCredential(userID, credential.ID, credential.PublicKey, credential.Flags.BackupEligible, credential.Flags.BackupState, time.Now().Unix()); err != nil {
-		log.Printf("Error saving credential for user ID %d: %v", userID, err)
-		http.Error(w, "Failed to save credential", http.StatusInternalServerError)
+	if !checkAttestation(w, h.Attestation, "new user "+pending.Username, credential) {
 		return
 	}
 
-	log.Printf("Registration completed successfully for user ID %d (%s)", userID, string(sessionDataStruct.UserID))
+	userID, inv, err := h.DB.RegisterUser(db.NewUser{
+		Username:    pending.Username,
+		DisplayName: pending.DisplayName,
+		Handle:      pending.Handle,
+		Role:        pending.Role,
+		Status:      pending.Status,
+		InviteHash:  pending.InviteHash,
+		Bootstrap:   pending.Bootstrap,
+	}, db.NewCredential{
+		ID:                credential.ID,
+		PublicKey:         credential.PublicKey,
+		AAGUID:            credential.Authenticator.AAGUID,
+		AttestationFormat: credential.AttestationType,
+		BackupEligible:    credential.Flags.BackupEligible,
+		BackupState:       credential.Flags.BackupState,
+	}, time.Now().Unix())
+	switch {
+	case err == db.ErrInviteInvalid:
+		log.Printf("Registration failed: invite for %s was used up or revoked meanwhile, IP: %s", pending.Username, r.RemoteAddr)
+		http.Error(w, "This invite is invalid, has expired or has already been used", http.StatusForbidden)
+		return
+	case err == db.ErrBootstrapUsed:
+		log.Printf("Registration failed: an admin registered before %s, IP: %s", pending.Username, r.RemoteAddr)
+		http.Error(w, "This setup link is invalid or an admin already exists", http.StatusForbidden)
+		return
+	case err == db.ErrUsernameTaken:
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error creating user %s: %v", pending.Username, err)
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+	delete(sess.Values, "pendingRegistration")
+
+	if pending.InviteHash != "" {
+		log.Printf("Invite %d used by %s (%d of %d uses)", inv.ID, pending.Username, inv.Uses, inv.MaxUses)
+	}
+	if pending.Bootstrap {
+		log.Printf("User %s registered as admin (ADMIN_BOOTSTRAP_TOKEN)", pending.Username)
+	}
+	if pending.Status == "pending" {
+		log.Printf("User %s is waiting for approval", pending.Username)
+	}
+
+	log.Printf("Registration completed successfully for user ID %d (%s)", userID, pending.Username)
 
 	delete(sess.Values, "registration")
-	sess.Values["authenticated"] = true
-	sess.Values["userID"] = userID
-	sess.Values["username"] = string(sessionDataStruct.UserID)
-	sess.Save(r, w)
+	if err := signIn(h.DB, w, r, sess, userID, pending.Username, base64.RawURLEncoding.EncodeToString(credential.ID)); err != nil {
+		log.Printf("Error saving session for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := issueRecoveryCodes(h.DB, userID)
+	if err != nil {
+		log.Printf("Error creating recovery codes for user ID %d: %v", userID, err)
+	}
+
+	status, _ := h.DB.GetUserStatus(userID)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "success",
+		"recovery_codes": codes,
+		"account_status": status,
+	})
 }
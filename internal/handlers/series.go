@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"database/sql"
+	"door-control/internal/db"
+	"door-control/internal/models"
+	"door-control/internal/recurrence"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// studioLocation is the time zone recurrence rules are expanded in, so that
+// "every Tuesday 19:00" stays at 19:00 local time across DST changes.
+func studioLocation() *time.Location {
+	if name := os.Getenv("STUDIO_TIMEZONE"); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err == nil {
+			return loc
+		}
+		log.Printf("Invalid STUDIO_TIMEZONE %q, using local time: %v", name, err)
+	}
+	return time.Local
+}
+
+// expandSeries turns a rule and its excluded dates into occurrence start
+// times (unix seconds) and the EXDATE list stored with the series.
+func expandSeries(rule string, startTime int64, exdates []int64) ([]int64, string, error) {
+	loc := studioLocation()
+	excluded := make([]time.Time, 0, len(exdates))
+	stored := make([]string, 0, len(exdates))
+	for _, ex := range exdates {
+		excluded = append(excluded, time.Unix(ex, 0).In(loc))
+		stored = append(stored, strconv.FormatInt(ex, 10))
+	}
+
+	starts, err := recurrence.Expand(rule, time.Unix(startTime, 0).In(loc), excluded)
+	if err != nil {
+		return nil, "", err
+	}
+
+	occurrences := make([]int64, 0, len(starts))
+	for _, t := range starts {
+		occurrences = append(occurrences, t.Unix())
+	}
+	return occurrences, strings.Join(stored, ","), nil
+}
+
+func (h *BookingHandler) createSeries(w http.ResponseWriter, r *http.Request, event db.AccessEvent, door db.Door, rule string, startTime, endTime int64, exdates []int64) {
+	userID := event.UserID
+	event.Details = rule
+
+	occurrences, stored, err := expandSeries(rule, startTime, exdates)
+	if err != nil {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "invalid_rule")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	duration := endTime - startTime
+	seriesID, bookingIDs, err := h.DB.CreateBookingSeries(userID, door.ID, rule, stored, startTime, duration, occurrences, time.Now().Unix())
+	if writeBookingConflict(w, err, door) {
+		log.Printf("Booking series conflict for user ID %d at %s: rule=%q - %v", userID, door.Name, rule, err)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, bookingConflictReason(err))
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating booking series for user ID %d: %v", userID, err)
+		recordAccess(h.DB, r, event, db.OutcomeError, "database_error")
+		http.Error(w, "Failed to create booking", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Booking series created - ID: %d, User ID: %d, Door: %s, Rule: %q, Occurrences: %d", seriesID, userID, door.Name, rule, len(bookingIDs))
+	event.BookingID = bookingIDs[0]
+	recordAccess(h.DB, r, event, db.OutcomeAllowed, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "success",
+		"series_id":   seriesID,
+		"booking_ids": bookingIDs,
+		"occurrences": occurrences,
+	})
+}
+
+// ownedSeries is the series counterpart of ownedBooking.
+func (h *BookingHandler) ownedSeries(w http.ResponseWriter, r *http.Request) (int64, map[string]interface{}, bool) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, nil, false
+	}
+
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	if !accountActive(w, h.DB, userID) {
+		return 0, nil, false
+	}
+
+	seriesID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid series ID", http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	series, err := h.DB.GetBookingSeries(seriesID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Series not found", http.StatusNotFound)
+		return 0, nil, false
+	}
+	if err != nil {
+		log.Printf("Error loading booking series %d: %v", seriesID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, nil, false
+	}
+
+	if series["user_id"].(int64) != userID && !h.can(userID, models.PermManageBookings) {
+		log.Printf("Series change denied: user ID %d does not own series %d, IP: %s", userID, seriesID, r.RemoteAddr)
+		http.Error(w, "Series not found", http.StatusNotFound)
+		return 0, nil, false
+	}
+
+	if series["status"] != "active" {
+		http.Error(w, "Series is already "+series["status"].(string), http.StatusConflict)
+		return 0, nil, false
+	}
+
+	return userID, series, true
+}
+
+func (h *BookingHandler) CancelSeries(w http.ResponseWriter, r *http.Request) {
+	userID, series, ok := h.ownedSeries(w, r)
+	if !ok {
+		return
+	}
+	seriesID := series["id"].(int64)
+
+	if err := h.DB.CancelBookingSeries(seriesID, userID, time.Now().Unix()); err != nil {
+		log.Printf("Error cancelling booking series %d for user ID %d: %v", seriesID, userID, err)
+		http.Error(w, "Failed to cancel series", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Booking series cancelled - ID: %d, by User ID: %d, IP: %s", seriesID, userID, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "success",
+		"series_id": seriesID,
+	})
+}
+
+// UpdateSeries replaces the rule of a series. Occurrences that already
+// started or were moved on their own are kept; all later ones are
+// regenerated from the new rule, except those that were cancelled.
+func (h *BookingHandler) UpdateSeries(w http.ResponseWriter, r *http.Request) {
+	userID, series, ok := h.ownedSeries(w, r)
+	if !ok {
+		return
+	}
+	seriesID := series["id"].(int64)
+
+	var requestData struct {
+		StartTime int64   `json:"start_time"`
+		EndTime   int64   `json:"end_time"`
+		RRule     string  `json:"rrule"`
+		ExDates   []int64 `json:"exdates"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request data", http.StatusBadRequest)
+		return
+	}
+
+	if requestData.StartTime == 0 {
+		requestData.StartTime = series["start_time"].(int64)
+	}
+	if requestData.EndTime == 0 {
+		requestData.EndTime = requestData.StartTime + series["duration"].(int64)
+	}
+	if requestData.RRule == "" {
+		requestData.RRule = series["rrule"].(string)
+	}
+	if requestData.EndTime <= requestData.StartTime {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return
+	}
+
+	var storedExDates []int64
+	for _, ex := range strings.Split(series["exdates"].(string), ",") {
+		if t, err := strconv.ParseInt(ex, 10, 64); err == nil {
+			storedExDates = append(storedExDates, t)
+		}
+	}
+
+	// Cancelled and moved occurrences are recorded by their original start
+	// time. Map those onto the occurrence at the same position in the new
+	// rule so that they still apply when the series changes its time or day.
+	loc := studioLocation()
+	remap, err := recurrence.Remap(series["rrule"].(string), time.Unix(series["start_time"].(int64), 0).In(loc),
+		requestData.RRule, time.Unix(requestData.StartTime, 0).In(loc), len(storedExDates))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Stored EXDATEs include occurrences cancelled on their own, so they are
+	// kept even when the request sends its own list.
+	excluded := make(map[int64]bool, len(requestData.ExDates))
+	for _, ex := range requestData.ExDates {
+		excluded[ex] = true
+	}
+	for _, t := range storedExDates {
+		if moved, ok := remap[t]; ok {
+			t = moved
+		}
+		if !excluded[t] {
+			excluded[t] = true
+			requestData.ExDates = append(requestData.ExDates, t)
+		}
+	}
+
+	occurrences, stored, err := expandSeries(requestData.RRule, requestData.StartTime, requestData.ExDates)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().Unix()
+	var upcoming []int64
+	for _, start := range occurrences {
+		if start > now {
+			upcoming = append(upcoming, start)
+		}
+	}
+
+	duration := requestData.EndTime - requestData.StartTime
+	bookingIDs, err := h.DB.RescheduleBookingSeries(seriesID, userID, requestData.RRule, stored, requestData.StartTime, duration, upcoming, remap, now)
+	if errors.Is(err, db.ErrBookingConflict) || errors.Is(err, db.ErrRoomFull) {
+		log.Printf("Booking series reschedule conflict for user ID %d: series=%d, rule=%q - %v", userID, seriesID, requestData.RRule, err)
+		door, _ := h.DB.GetDoor(series["door_id"].(int64))
+		writeBookingConflict(w, err, door)
+		return
+	}
+	if err != nil {
+		log.Printf("Error rescheduling booking series %d for user ID %d: %v", seriesID, userID, err)
+		http.Error(w, "Failed to update series", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Booking series rescheduled - ID: %d, by User ID: %d, Rule: %q, Upcoming occurrences: %d", seriesID, userID, requestData.RRule, len(bookingIDs))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "success",
+		"series_id":   seriesID,
+		"booking_ids": bookingIDs,
+	})
+}
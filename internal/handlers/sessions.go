@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"database/sql"
+	"door-control/internal/db"
+	"door-control/internal/sessionstore"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// signIn marks the session as authenticated. The session gets a fresh token
+// so that a token handed out before login cannot be reused afterwards.
+func signIn(database *db.DB, w http.ResponseWriter, r *http.Request, sess *sessions.Session, userID int64, username, credentialID string) error {
+	if sess.ID != "" {
+		if err := database.DeleteSession(sessionstore.TokenHash(sess.ID)); err != nil {
+			log.Printf("Error deleting pre-login session: %v", err)
+		}
+		sess.ID = ""
+	}
+
+	sess.Values["authenticated"] = true
+	sess.Values["userID"] = userID
+	sess.Values["username"] = username
+	sess.Values["credentialID"] = credentialID
+	return sess.Save(r, w)
+}
+
+type SessionsHandler struct {
+	DB    *db.DB
+	Store sessions.Store
+}
+
+func (h *SessionsHandler) currentUser(w http.ResponseWriter, r *http.Request) (*sessions.Session, int64, bool) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, 0, false
+	}
+
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return sess, userID, true
+}
+
+// ListSessions returns the devices the user is signed in on.
+func (h *SessionsHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	sess, userID, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := h.DB.ListUserSessions(userID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Error listing sessions for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	current := sessionstore.TokenHash(sess.ID)
+	result := make([]map[string]interface{}, 0, len(list))
+	for _, s := range list {
+		result = append(result, map[string]interface{}{
+			"id":           s.ID,
+			"user_agent":   s.UserAgent,
+			"ip":           s.IP,
+			"created_at":   s.CreatedAt,
+			"last_seen_at": s.LastSeenAt,
+			"expires_at":   s.ExpiresAt,
+			"current":      s.TokenHash == current,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *SessionsHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	_, userID, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	// Only the owner may revoke through this endpoint; admins use the
+	// admin API.
+	owner, err := h.DB.GetSessionOwner(id)
+	if err == sql.ErrNoRows || (err == nil && owner != userID) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		_, err = h.DB.RevokeSession(id)
+	}
+	if err != nil {
+		log.Printf("Error revoking session %d for user ID %d: %v", id, userID, err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Session %d revoked by user ID %d from IP: %s", id, userID, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "success"})
+}
+
+// RevokeOtherSessions signs the user out on every device but this one.
+func (h *SessionsHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	sess, userID, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := h.DB.RevokeUserSessions(userID, sessionstore.TokenHash(sess.ID))
+	if err != nil {
+		log.Printf("Error revoking sessions for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User ID %d signed out %d other sessions from IP: %s", userID, n, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"revoked": n,
+	})
+}
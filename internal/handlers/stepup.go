@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"door-control/internal/db"
+	"door-control/internal/models"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/sessions"
+)
+
+// stepUpMaxAge is how long a step-up challenge can be answered.
+const stepUpMaxAge = 2 * time.Minute
+
+// stepUpRecoveryCodes is the target of a step-up that confirms new recovery
+// codes rather than opening a door. Door IDs are positive.
+const stepUpRecoveryCodes int64 = -1
+
+func stepUpKey(doorID int64) string {
+	return fmt.Sprintf("stepUp:%d", doorID)
+}
+
+// stepUpFresh reports whether the session answered a step-up for the door
+// within the door's grace window.
+func stepUpFresh(sess *sessions.Session, door db.Door, now time.Time) bool {
+	last, ok := sess.Values[stepUpKey(door.ID)].(int64)
+	return ok && door.StepUpGraceSeconds > 0 && now.Unix()-last < int64(door.StepUpGraceSeconds)
+}
+
+// stepUpChallenge binds a WebAuthn challenge to a target and a time: 16
+// random bytes followed by the door ID (or stepUpRecoveryCodes) and the
+// Unix time, both big-endian.
+func stepUpChallenge(target int64, now time.Time) ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge[:16]); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint64(challenge[16:24], uint64(target))
+	binary.BigEndian.PutUint64(challenge[24:], uint64(now.Unix()))
+	return challenge, nil
+}
+
+// BeginUnlockStepUp returns WebAuthn assertion options when the door needs a
+// fresh user-verified assertion before it opens, or step_up false when it
+// does not.
+func (h *BookingHandler) BeginUnlockStepUp(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+	if !accountActive(w, h.DB, userID) {
+		return
+	}
+
+	var requestData struct {
+		DoorID int64 `json:"door_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request data", http.StatusBadRequest)
+		return
+	}
+
+	door, err := h.resolveDoor(requestData.DoorID, false)
+	if err == errDoorRequired {
+		http.Error(w, "Door ID required", http.StatusBadRequest)
+		return
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Unknown door", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving door %d: %v", requestData.DoorID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	if !door.StepUp || stepUpFresh(sess, door, now) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"step_up": false})
+		return
+	}
+
+	options, err := beginStepUp(h.DB, h.WebAuthn, sess, "unlockStepUp", userID, door.ID, now)
+	if err != nil {
+		log.Printf("Error beginning step-up for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to begin confirmation", http.StatusInternalServerError)
+		return
+	}
+
+	if err := sess.Save(r, w); err != nil {
+		log.Printf("Error saving session for user ID %d: %v", userID, err)
+		http.Error(w, "Session error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"step_up": true,
+		"options": options,
+	})
+}
+
+// checkStepUp verifies the step-up assertion sent with an unlock request
+// for doors that need one. The challenge is used up either way. On failure
+// it records the denial, responds and returns false.
+func (h *BookingHandler) checkStepUp(w http.ResponseWriter, r *http.Request, sess *sessions.Session, event *db.AccessEvent, door db.Door, assertion json.RawMessage) bool {
+	now := time.Now()
+	if !door.StepUp || stepUpFresh(sess, door, now) {
+		return true
+	}
+
+	credentialID, reason, message := verifyStepUp(h.DB, h.WebAuthn, r, sess, event, "unlockStepUp", door.ID, assertion, now)
+	switch reason {
+	case "":
+	case "step_up_required":
+		message = fmt.Sprintf("Confirm with your passkey to open %s.", door.Name)
+	case "step_up_wrong_target":
+		reason, message = "step_up_wrong_door", "This confirmation was for another door. Please try again."
+	}
+	if reason != "" {
+		log.Printf("Door unlock denied for user ID %d at %s: %s", event.UserID, door.Name, reason)
+		recordAccess(h.DB, r, *event, db.OutcomeDenied, reason)
+		sess.Save(r, w)
+		writeUnlockError(w, http.StatusUnauthorized, reason, map[string]interface{}{
+			"message":          message,
+			"step_up_required": true,
+		})
+		return false
+	}
+
+	if event.Details == "" {
+		event.Details = "step-up with " + credentialID
+	}
+	sess.Values[stepUpKey(door.ID)] = now.Unix()
+	if err := sess.Save(r, w); err != nil {
+		log.Printf("Error saving session for user ID %d: %v", event.UserID, err)
+	}
+	return true
+}
+
+// beginStepUp starts a user-verified assertion whose challenge is bound to
+// target, a door ID or stepUpRecoveryCodes, and keeps the WebAuthn session
+// in sess under key. The caller saves the session.
+func beginStepUp(database *db.DB, wa *webauthn.WebAuthn, sess *sessions.Session, key string, userID, target int64, now time.Time) (*protocol.CredentialAssertion, error) {
+	user, err := models.LoadUser(database, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := stepUpChallenge(target, now)
+	if err != nil {
+		return nil, err
+	}
+
+	options, session, err := wa.BeginLogin(user,
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+		webauthn.WithChallenge(challenge),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionData, _ := json.Marshal(session)
+	sess.Values[key] = sessionData
+	return options, nil
+}
+
+// verifyStepUp checks a step-up assertion against the challenge kept in sess
+// under key, which is used up either way. It returns the ID of the passkey
+// used, or the reason and message to deny with. A challenge issued for
+// another target is denied as step_up_wrong_target.
+func verifyStepUp(database *db.DB, wa *webauthn.WebAuthn, r *http.Request, sess *sessions.Session, event *db.AccessEvent, key string, target int64, assertion json.RawMessage, now time.Time) (string, string, string) {
+	const failed = "Passkey confirmation failed. Please try again."
+
+	sessionData, _ := sess.Values[key].([]byte)
+	delete(sess.Values, key)
+	if len(assertion) == 0 || string(assertion) == "null" || sessionData == nil {
+		return "", "step_up_required", "Confirm with your passkey to continue."
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(sessionData, &session); err != nil {
+		return "", "step_up_failed", failed
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(session.Challenge)
+	if err != nil || len(challenge) != 32 {
+		return "", "step_up_failed", failed
+	}
+	if int64(binary.BigEndian.Uint64(challenge[16:24])) != target {
+		return "", "step_up_wrong_target", "This confirmation was for something else. Please try again."
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(challenge[24:])), 0)
+	if now.Sub(issued) > stepUpMaxAge {
+		return "", "step_up_expired", "The passkey confirmation took too long. Please try again."
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(assertion)
+	if err != nil {
+		event.Details = err.Error()
+		return "", "step_up_failed", failed
+	}
+	user, err := models.LoadUser(database, event.UserID)
+	if err != nil {
+		log.Printf("Error loading user ID %d: %v", event.UserID, err)
+		return "", "step_up_failed", failed
+	}
+	credential, err := wa.ValidateLogin(user, session, parsed)
+	if err != nil {
+		event.Details = err.Error()
+		return "", "step_up_failed", failed
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	if credential.Authenticator.CloneWarning {
+		handleCloneWarning(database, r, event, credential)
+	}
+	flag, err := database.GetCredentialFlag(credentialID)
+	if err != nil {
+		log.Printf("Error checking credential flag for user ID %d: %v", event.UserID, err)
+		return "", "step_up_failed", failed
+	}
+	if flag != "" {
+		return "", "credential_flagged", cloneFlagMessage(flag)
+	}
+	if err := database.UpdateSignCount(credential.ID, int(credential.Authenticator.SignCount), now.Unix()); err != nil {
+		log.Printf("Error updating sign count for user ID %d: %v", event.UserID, err)
+	}
+	return credentialID, "", ""
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"door-control/internal/actuator"
+	"door-control/internal/db"
+	"door-control/internal/geofence"
+	"door-control/internal/presence"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRadiusM      = 50.0
+	defaultMaxAccuracyM = 100.0
+	actuatorTimeout     = actuator.MaxUnlockTime
+)
+
+// writeUnlockError sends a failed unlock to the client. reason is the same
+// code that is recorded in the audit log.
+func writeUnlockError(w http.ResponseWriter, status int, reason string, payload map[string]interface{}) {
+	payload["status"] = "error"
+	payload["reason"] = reason
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
+
+// presenceClaim is what the client sends to show it is at the door: its
+// location, and the code from the door's QR display if it scanned one.
+type presenceClaim struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	AccuracyM float64 `json:"accuracy"`
+	Code      string  `json:"code"`
+}
+
+// doorFence returns the door's geofence with defaults filled in.
+func doorFence(door db.Door) (geofence.Fence, error) {
+	fence := geofence.Fence{
+		Center:       geofence.Point{Lat: door.Latitude, Lon: door.Longitude},
+		RadiusM:      door.RadiusM,
+		MaxAccuracyM: door.MaxAccuracyM,
+	}
+	if fence.RadiusM <= 0 {
+		fence.RadiusM = defaultRadiusM
+	}
+	if fence.MaxAccuracyM <= 0 {
+		fence.MaxAccuracyM = defaultMaxAccuracyM
+	}
+	if len(door.Geofence) > 0 {
+		polygons, err := geofence.ParseGeoJSON(door.Geofence)
+		if err != nil {
+			return fence, err
+		}
+		fence.Polygons = polygons
+	}
+	return fence, nil
+}
+
+func geofenceMessage(reason string, door db.Door, fence geofence.Fence, claim presenceClaim) string {
+	switch reason {
+	case geofence.ReasonNoLocation:
+		return "Your location could not be determined. Please enable location services and try again."
+	case geofence.ReasonLowAccuracy:
+		return fmt.Sprintf("Your location is only accurate to %.0f m, %s needs %.0f m or better. Try again near a window or with Wi-Fi turned on.",
+			claim.AccuracyM, door.Name, fence.MaxAccuracyM)
+	}
+	return fmt.Sprintf("Please go to %s for the door to open.", door.Name)
+}
+
+func mapsURL(door db.Door) string {
+	return fmt.Sprintf("https://www.google.com/maps/dir/?api=1&destination=%.6f,%.6f", door.Latitude, door.Longitude)
+}
+
+func (h *BookingHandler) UnlockDoor(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		log.Printf("Door unlock denied: unauthorized from IP: %s", r.RemoteAddr)
+		recordAccess(h.DB, r, db.AccessEvent{Type: db.EventUnlock}, db.OutcomeDenied, "unauthenticated")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, ok := sess.Values["userID"].(int64)
+	if !ok {
+		log.Printf("Door unlock denied: invalid session from IP: %s", r.RemoteAddr)
+		recordAccess(h.DB, r, db.AccessEvent{Type: db.EventUnlock}, db.OutcomeDenied, "invalid_session")
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	event := db.AccessEvent{
+		Type:         db.EventUnlock,
+		UserID:       userID,
+		CredentialID: sessionCredential(sess),
+	}
+
+	if !accountActive(w, h.DB, userID) {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "account_inactive")
+		return
+	}
+
+	flag, err := h.DB.GetCredentialFlag(event.CredentialID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error checking credential flag for user ID %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if flag != "" {
+		log.Printf("Door unlock denied: credential %s of user ID %d is flagged (%s)", event.CredentialID, userID, flag)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "credential_flagged")
+		writeUnlockError(w, http.StatusForbidden, "credential_flagged", map[string]interface{}{
+			"message": cloneFlagMessage(flag),
+		})
+		return
+	}
+
+	var requestData struct {
+		presenceClaim
+		DoorID    int64           `json:"door_id"`
+		Assertion json.RawMessage `json:"assertion"`
+		Nonce     string          `json:"nonce"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "invalid_request")
+		http.Error(w, "Invalid request data", http.StatusBadRequest)
+		return
+	}
+
+	event.DoorID = requestData.DoorID
+	if requestData.Nonce == "" {
+		log.Printf("Door unlock denied: no nonce from user ID %d", userID)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "nonce_required")
+		writeUnlockError(w, http.StatusForbidden, "nonce_required", map[string]interface{}{
+			"message": "This unlock request has expired. Please try again.",
+		})
+		return
+	}
+	err = h.DB.ConsumeUnlockNonce(hashUnlockNonce(requestData.Nonce), userID, time.Now().Unix())
+	if err == sql.ErrNoRows {
+		log.Printf("Door unlock denied: invalid or reused nonce from user ID %d", userID)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "invalid_nonce")
+		writeUnlockError(w, http.StatusForbidden, "invalid_nonce", map[string]interface{}{
+			"message": "This unlock request has expired. Please try again.",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error consuming unlock nonce for user ID %d: %v", userID, err)
+		recordAccess(h.DB, r, event, db.OutcomeError, "database_error")
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Door unlock attempt by user ID: %d for door ID: %d from IP: %s", userID, requestData.DoorID, r.RemoteAddr)
+
+	door, err := h.resolveDoor(requestData.DoorID, false)
+	if err == errDoorRequired {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "door_required")
+		http.Error(w, "Door ID required", http.StatusBadRequest)
+		return
+	}
+	if err == sql.ErrNoRows {
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "unknown_door")
+		http.Error(w, "Unknown door", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving door %d: %v", requestData.DoorID, err)
+		recordAccess(h.DB, r, event, db.OutcomeError, "database_error")
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	event.DoorID = door.ID
+
+	currentTime := time.Now().Unix()
+	booking, err := h.DB.GetActiveBookingForDoor(userID, door, currentTime)
+	if err != nil {
+		log.Printf("Door unlock denied for user ID %d at %s: no active booking found - %v", userID, door.Name, err)
+		recordAccess(h.DB, r, event, db.OutcomeDenied, "no_active_booking")
+		writeUnlockError(w, http.StatusOK, "no_active_booking", map[string]interface{}{
+			"message": fmt.Sprintf("No active booking for %s. Please book a time slot first.", door.Name),
+		})
+		return
+	}
+
+	event.BookingID = booking["id"].(int64)
+	if !h.checkStepUp(w, r, sess, &event, door, requestData.Assertion) {
+		return
+	}
+	h.openDoor(w, r, event, door, requestData.presenceClaim, fmt.Sprintf("user:%d", userID), fmt.Sprintf("user ID %d", userID))
+}
+
+// openDoor checks that the client is at the door, by QR code, geofence or
+// both depending on the door's presence mode, and opens it. Each QR code
+// opens a door only once per subject, such as "user:3" or "guest:7"; it is
+// only used up once the door has opened. who names the person for the log.
+func (h *BookingHandler) openDoor(w http.ResponseWriter, r *http.Request, event db.AccessEvent, door db.Door, claim presenceClaim, subject, who string) {
+	mode := door.Presence
+	if mode == "" {
+		mode = presence.ModeGPS
+	}
+
+	codeValid, codeUsed := false, false
+	var counter uint64
+	if claim.Code != "" && mode != presence.ModeGPS {
+		var ok bool
+		counter, ok = presence.Verify(presence.DoorKey(h.PresenceSecret, door.ID), claim.Code, time.Now())
+		if ok {
+			used, err := h.DB.PresenceCodeUsed(door.ID, counter, subject)
+			switch {
+			case err != nil:
+				log.Printf("Error checking QR code use for %s at %s: %v", who, door.Name, err)
+			case used:
+				codeUsed = true
+				log.Printf("Door unlock for %s at %s: QR code already used", who, door.Name)
+			default:
+				codeValid = true
+			}
+		} else {
+			log.Printf("Door unlock for %s at %s: invalid or expired QR code", who, door.Name)
+		}
+	}
+
+	if mode == presence.ModeQR || mode == presence.ModeGPSAndQR {
+		reason, message := "", ""
+		switch {
+		case claim.Code == "":
+			reason, message = "presence_code_required", fmt.Sprintf("Scan the QR code at %s to open it.", door.Name)
+		case codeUsed:
+			reason, message = "presence_code_used", "This QR code has already been used. Please scan it again once it changes."
+		case !codeValid:
+			reason, message = "invalid_presence_code", "This QR code has expired. Please scan it again."
+		}
+		if reason != "" {
+			log.Printf("Door unlock denied for %s at %s: %s", who, door.Name, reason)
+			recordAccess(h.DB, r, event, db.OutcomeDenied, reason)
+			writeUnlockError(w, http.StatusOK, reason, map[string]interface{}{
+				"message":       message,
+				"scan_required": true,
+			})
+			return
+		}
+	}
+
+	distance := 0.0
+	if mode == presence.ModeGPS || mode == presence.ModeGPSAndQR || (mode == presence.ModeGPSOrQR && !codeValid) {
+		fence, err := doorFence(door)
+		if err != nil {
+			log.Printf("✗ DOOR NOT UNLOCKED - invalid geofence for door %s: %v", door.Name, err)
+			recordAccess(h.DB, r, event, db.OutcomeError, "geofence_invalid")
+			writeUnlockError(w, http.StatusInternalServerError, "geofence_invalid", map[string]interface{}{
+				"message": "This door is not configured correctly. Please contact the studio.",
+			})
+			return
+		}
+
+		fix := geofence.Fix{
+			Point:     geofence.Point{Lat: claim.Latitude, Lon: claim.Longitude},
+			AccuracyM: claim.AccuracyM,
+		}
+		result := fence.Check(fix)
+		distance = result.DistanceM / 1000
+		if result.Reason != geofence.ReasonNoLocation {
+			event.DistanceM = &result.DistanceM
+			event.AccuracyM = &claim.AccuracyM
+		}
+
+		log.Printf("Door unlock location check - %s, Door: %s, Distance: %.3f km, Accuracy: %.0f m, Location: (%.6f, %.6f)",
+			who, door.Name, distance, claim.AccuracyM, claim.Latitude, claim.Longitude)
+
+		if result.Reason != "" {
+			log.Printf("Door unlock denied for %s at %s: %s (%.0f m from the door, accuracy %.0f m, max %.0f m)",
+				who, door.Name, result.Reason, result.DistanceM, claim.AccuracyM, fence.MaxAccuracyM)
+			recordAccess(h.DB, r, event, db.OutcomeDenied, result.Reason)
+			payload := map[string]interface{}{
+				"message":        geofenceMessage(result.Reason, door, fence, claim),
+				"accuracy_m":     claim.AccuracyM,
+				"max_accuracy_m": fence.MaxAccuracyM,
+				"can_scan":       mode == presence.ModeGPSOrQR,
+			}
+			if result.Reason == geofence.ReasonOutside {
+				payload["distance"] = distance
+				payload["distance_m"] = result.DistanceM
+				payload["show_navigate"] = true
+				payload["maps_url"] = mapsURL(door)
+				payload["studio_lat"] = door.Latitude
+				payload["studio_lon"] = door.Longitude
+			}
+			writeUnlockError(w, http.StatusOK, result.Reason, payload)
+			return
+		}
+	}
+
+	doorKey := strconv.FormatInt(door.ID, 10)
+	act, duration, err := h.Actuators.ForDoor(doorKey, door.ActuatorConfig)
+	if err != nil {
+		log.Printf("✗ DOOR NOT UNLOCKED - no actuator for door %s: %v", door.Name, err)
+		recordAccess(h.DB, r, event, db.OutcomeError, "actuator_not_configured")
+		writeUnlockError(w, http.StatusInternalServerError, "actuator_not_configured", map[string]interface{}{
+			"message":   "This door is not configured correctly. Please contact the studio.",
+			"confirmed": false,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), actuatorTimeout)
+	defer cancel()
+
+	if err := act.Unlock(ctx, doorKey, duration); err != nil {
+		log.Printf("✗ DOOR NOT UNLOCKED - actuator failed for %s, Door: %s, Booking ID: %d: %v", who, door.Name, event.BookingID, err)
+		event.Details = err.Error()
+		recordAccess(h.DB, r, event, db.OutcomeError, "actuator_failed")
+		writeUnlockError(w, http.StatusBadGateway, "actuator_failed", map[string]interface{}{
+			"message":   "The door did not respond. Please try again or contact the studio.",
+			"confirmed": false,
+		})
+		return
+	}
+
+	log.Printf("✓ DOOR UNLOCKED - %s, Door: %s, Booking ID: %d, Distance: %.3f km, IP: %s",
+		who, door.Name, event.BookingID, distance, r.RemoteAddr)
+	recordAccess(h.DB, r, event, db.OutcomeAllowed, "")
+
+	if codeValid {
+		if err := h.DB.UsePresenceCode(door.ID, counter, subject, time.Now().Unix()); err != nil && err != db.ErrPresenceCodeUsed {
+			log.Printf("Error recording QR code use for %s at %s: %v", who, door.Name, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "success",
+		"message":   fmt.Sprintf("%s unlocked! Welcome to Waterhouse Studios.", door.Name),
+		"door_id":   door.ID,
+		"confirmed": true,
+		"duration":  int(duration.Seconds()),
+	})
+}
+
+func (h *BookingHandler) DoorStatus(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.Store.Get(r, "webauthn-session")
+	if err != nil || sess.Values["authenticated"] != true {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	doorID, _ := strconv.ParseInt(r.URL.Query().Get("door_id"), 10, 64)
+	door, err := h.resolveDoor(doorID, false)
+	if err == errDoorRequired {
+		http.Error(w, "Door ID required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unknown door", http.StatusNotFound)
+		return
+	}
+
+	doorKey := strconv.FormatInt(door.ID, 10)
+	state := actuator.StateUnknown
+	if act, _, err := h.Actuators.ForDoor(doorKey, door.ActuatorConfig); err == nil {
+		ctx, cancel := context.WithTimeout(r.Context(), actuatorTimeout)
+		defer cancel()
+
+		if state, err = act.Status(ctx, doorKey); err != nil {
+			log.Printf("Error reading status of door %s: %v", door.Name, err)
+			state = actuator.StateUnknown
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"door_id": door.ID,
+		"name":    door.Name,
+		"state":   state,
+	})
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"door-control/internal/db"
+	"door-control/internal/models"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+type CurrentUser struct {
+	ID   int64
+	Role models.Role
+}
+
+type contextKey struct{}
+
+// UserFromContext returns the user stored by Authorizer.Require.
+func UserFromContext(ctx context.Context) (CurrentUser, bool) {
+	u, ok := ctx.Value(contextKey{}).(CurrentUser)
+	return u, ok
+}
+
+type Authorizer struct {
+	DB    *db.DB
+	Store sessions.Store
+}
+
+// Require only lets signed-in users whose role grants perm through. The role
+// is read from the database on every request so that demoting a user takes
+// effect immediately.
+func (a *Authorizer) Require(perm models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, err := a.Store.Get(r, "webauthn-session")
+		userID, ok := sess.Values["userID"].(int64)
+		if err != nil || sess.Values["authenticated"] != true || !ok {
+			if strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		role, err := a.DB.GetUserRole(userID)
+		if err != nil {
+			log.Printf("Error loading role for user ID %d: %v", userID, err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if status, err := a.DB.GetUserStatus(userID); err != nil || status != "active" {
+			log.Printf("Permission %s denied for user ID %d: account not active", perm, userID)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if !models.Role(role).Can(perm) {
+			log.Printf("Permission %s denied for user ID %d (role %s) on %s from IP: %s", perm, userID, role, r.URL.Path, r.RemoteAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKey{}, CurrentUser{ID: userID, Role: models.Role(role)})
+		next(w, r.WithContext(ctx))
+	}
+}
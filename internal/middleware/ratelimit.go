@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -66,10 +68,7 @@ func (i *IPRateLimiter) cleanupOldEntries() {
 
 func (i *IPRateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr
-		if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
-			ip = forwardedFor
-		}
+		ip := ClientIP(r)
 
 		limiter := i.GetLimiter(ip)
 		if !limiter.Allow() {
@@ -81,3 +80,16 @@ func (i *IPRateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
+
+// ClientIP is the address the request came from, preferring the
+// X-Forwarded-For header set by the reverse proxy.
+func ClientIP(r *http.Request) string {
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		client, _, _ := strings.Cut(forwardedFor, ",")
+		return strings.TrimSpace(client)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,44 @@
+package models
+
+type Role string
+
+const (
+	RoleMember Role = "member"
+	RoleStaff  Role = "staff"
+	RoleAdmin  Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermBook            Permission = "book"
+	PermViewAllBookings Permission = "bookings:view"
+	PermManageBookings  Permission = "bookings:manage"
+	PermViewUsers       Permission = "users:view"
+	PermManageUsers     Permission = "users:manage"
+	PermManageRoles     Permission = "roles:manage"
+	PermViewAudit       Permission = "audit:view"
+	PermViewDoors       Permission = "doors:view"
+	PermManageDoors     Permission = "doors:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleMember: {PermBook},
+	RoleStaff:  {PermBook, PermViewAllBookings, PermManageBookings, PermViewUsers, PermViewAudit, PermViewDoors},
+	RoleAdmin:  {PermBook, PermViewAllBookings, PermManageBookings, PermViewUsers, PermManageUsers, PermManageRoles, PermViewAudit, PermViewDoors, PermManageDoors},
+}
+
+func ParseRole(s string) (Role, bool) {
+	r := Role(s)
+	_, ok := rolePermissions[r]
+	return r, ok
+}
+
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
@@ -8,14 +8,17 @@ import (
 
 type User struct {
 	ID          int64
+	Handle      []byte
 	Username    string
 	DisplayName string
 	Credentials []webauthn.Credential
 	DB          *db.DB
 }
 
+// WebAuthnID is the opaque user handle stored by authenticators. It is not
+// derived from the username, which can change.
 func (u User) WebAuthnID() []byte {
-	return []byte(u.Username)
+	return u.Handle
 }
 
 func (u User) WebAuthnName() string {
@@ -34,6 +37,33 @@ func (u User) WebAuthnCredentials() []webauthn.Credential {
 	return u.Credentials
 }
 
+// LoadUser returns the user with their passkeys.
+func LoadUser(database *db.DB, userID int64) (User, error) {
+	username, displayName, err := database.GetUserByID(userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	handle, err := database.GetUserHandle(userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	credentials, err := LoadUserCredentials(database, userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	return User{
+		ID:          userID,
+		Handle:      handle,
+		Username:    username,
+		DisplayName: displayName,
+		Credentials: credentials,
+		DB:          database,
+	}, nil
+}
+
 func LoadUserCredentials(database *db.DB, userID int64) ([]webauthn.Credential, error) {
 	credIDs, err := database.GetCredentialsByUserID(userID)
 	if err != nil {
@@ -42,21 +72,22 @@ func LoadUserCredentials(database *db.DB, userID int64) ([]webauthn.Credential,
 
 	var credentials []webauthn.Credential
 	for _, credID := range credIDs {
-		_, publicKey, signCount, backupEligible, backupState, err := database.GetCredential(credID)
+		stored, err := database.GetCredential(credID)
 		if err != nil {
 			continue
 		}
 
 		credentials = append(credentials, webauthn.Credential{
 			ID:              credID,
-			PublicKey:       publicKey,
-			AttestationType: "none",
+			PublicKey:       stored.PublicKey,
+			AttestationType: stored.AttestationFormat,
 			Flags: webauthn.CredentialFlags{
-				BackupEligible: backupEligible,
-				BackupState:    backupState,
+				BackupEligible: stored.BackupEligible,
+				BackupState:    stored.BackupState,
 			},
 			Authenticator: webauthn.Authenticator{
-				SignCount: uint32(signCount),
+				AAGUID:    stored.AAGUID,
+				SignCount: uint32(stored.SignCount),
 			},
 		})
 	}
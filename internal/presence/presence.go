@@ -0,0 +1,94 @@
+// Package presence generates the rotating codes shown as a QR code on door
+// displays. A code is a TOTP (RFC 6238) value computed with HMAC-SHA256
+// from a per-door key, so scanning it shows that the member stood in front
+// of the display within the last Period, plus Grace.
+package presence
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	Period = 30 * time.Second
+	Digits = 8
+	// Grace is how long the previous code is still accepted after it
+	// changed, so a code that changed while the member was opening the
+	// page still works.
+	Grace = 10 * time.Second
+)
+
+// Modes a door can use to check that the member is at the door.
+const (
+	ModeGPS      = "gps"
+	ModeQR       = "qr"
+	ModeGPSOrQR  = "gps_or_qr"
+	ModeGPSAndQR = "gps_and_qr"
+)
+
+// ValidMode reports whether mode is one of the modes above. The empty
+// string means ModeGPS.
+func ValidMode(mode string) bool {
+	switch mode {
+	case "", ModeGPS, ModeQR, ModeGPSOrQR, ModeGPSAndQR:
+		return true
+	}
+	return false
+}
+
+// DoorKey derives the code key of a door from the presence secret.
+func DoorKey(secret []byte, doorID int64) []byte {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "door-presence:%d", doorID)
+	return mac.Sum(nil)
+}
+
+// Code returns the code for the period that contains t.
+func Code(key []byte, t time.Time) string {
+	return code(key, uint64(t.Unix()/int64(Period.Seconds())))
+}
+
+// Expires returns when the code for t stops being shown.
+func Expires(t time.Time) time.Time {
+	step := int64(Period.Seconds())
+	return time.Unix((t.Unix()/step+1)*step, 0)
+}
+
+// Verify reports whether c is the code for t, or the code of the period
+// before if t is within Grace of the change. It returns the counter of the
+// period c belongs to, which callers use to accept each code only once.
+func Verify(key []byte, c string, t time.Time) (uint64, bool) {
+	if len(c) != Digits {
+		return 0, false
+	}
+	step := int64(Period.Seconds())
+	counter := uint64(t.Unix() / step)
+	if subtle.ConstantTimeCompare([]byte(code(key, counter)), []byte(c)) == 1 {
+		return counter, true
+	}
+	if counter > 0 && t.Unix()%step < int64(Grace.Seconds()) &&
+		subtle.ConstantTimeCompare([]byte(code(key, counter-1)), []byte(c)) == 1 {
+		return counter - 1, true
+	}
+	return 0, false
+}
+
+func code(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for range Digits {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%modulus)
+}
@@ -0,0 +1,95 @@
+package presence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCodeFormat(t *testing.T) {
+	key := DoorKey([]byte("secret"), 1)
+	now := time.Unix(1800000000, 0)
+	c := Code(key, now)
+	if len(c) != Digits {
+		t.Fatalf("Code = %q, want %d digits", c, Digits)
+	}
+	for _, r := range c {
+		if r < '0' || r > '9' {
+			t.Fatalf("Code = %q, want only digits", c)
+		}
+	}
+	if Code(key, now.Add(Period-time.Second)) != c {
+		t.Errorf("code changed within its period")
+	}
+	if Code(key, now.Add(Period)) == c {
+		t.Errorf("code did not change with the next period")
+	}
+}
+
+func TestDoorKey(t *testing.T) {
+	now := time.Unix(1800000000, 0)
+	if Code(DoorKey([]byte("secret"), 1), now) == Code(DoorKey([]byte("secret"), 2), now) {
+		t.Errorf("two doors share a code")
+	}
+	if Code(DoorKey([]byte("secret"), 1), now) == Code(DoorKey([]byte("other"), 1), now) {
+		t.Errorf("two secrets give the same code")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := DoorKey([]byte("secret"), 1)
+	// start is the beginning of a period.
+	start := time.Unix(1800000000, 0)
+	counter := uint64(start.Unix() / int64(Period.Seconds()))
+	shown := Code(key, start)
+
+	tests := []struct {
+		name        string
+		code        string
+		at          time.Time
+		want        bool
+		wantCounter uint64
+	}{
+		{"when shown", shown, start, true, counter},
+		{"end of its period", shown, start.Add(Period - time.Second), true, counter},
+		{"just after it changed", shown, start.Add(Period), true, counter},
+		{"end of the grace", shown, start.Add(Period + Grace - time.Second), true, counter},
+		{"after the grace", shown, start.Add(Period + Grace), false, 0},
+		{"two periods later", shown, start.Add(2 * Period), false, 0},
+		{"before it is shown", shown, start.Add(-time.Second), false, 0},
+		{"next code", Code(key, start.Add(Period)), start, false, 0},
+		{"other door", Code(DoorKey([]byte("secret"), 2), start), start, false, 0},
+		{"too short", shown[:Digits-1], start, false, 0},
+		{"too long", shown + "0", start, false, 0},
+		{"empty", "", start, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Verify(key, tt.code, tt.at)
+			if ok != tt.want || got != tt.wantCounter {
+				t.Errorf("Verify(%q, %s) = %d, %v, want %d, %v", tt.code, tt.at.Sub(start), got, ok, tt.wantCounter, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpires(t *testing.T) {
+	start := time.Unix(1800000000, 0)
+	for _, offset := range []time.Duration{0, time.Second, Period - time.Second} {
+		if got := Expires(start.Add(offset)); !got.Equal(start.Add(Period)) {
+			t.Errorf("Expires(start+%s) = %s, want %s", offset, got, start.Add(Period))
+		}
+	}
+}
+
+func TestValidMode(t *testing.T) {
+	for _, mode := range []string{"", ModeGPS, ModeQR, ModeGPSOrQR, ModeGPSAndQR} {
+		if !ValidMode(mode) {
+			t.Errorf("ValidMode(%q) = false", mode)
+		}
+	}
+	for _, mode := range []string{"nfc", "GPS", "gps,qr"} {
+		if ValidMode(mode) {
+			t.Errorf("ValidMode(%q) = true", mode)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// MaxOccurrences caps how many bookings a single series may create.
+const MaxOccurrences = 104
+
+var (
+	ErrNoRule        = errors.New("recurrence needs exactly one RRULE")
+	ErrUnbounded     = errors.New("recurrence rule needs an UNTIL or COUNT")
+	ErrTooMany       = fmt.Errorf("recurrence rule creates more than %d occurrences", MaxOccurrences)
+	ErrNoOccurrences = errors.New("recurrence rule does not produce any occurrence")
+)
+
+// Expand returns the start time of every occurrence of an RFC 5545 rule
+// anchored at dtstart. The rule is an RRULE value such as
+// "FREQ=WEEKLY;BYDAY=TU;COUNT=10", optionally prefixed with "RRULE:" and
+// followed by EXDATE lines. Occurrences are computed in dtstart's location so
+// weekly slots keep their wall-clock time across DST changes.
+func Expand(rule string, dtstart time.Time, exdates []time.Time) ([]time.Time, error) {
+	return expand(rule, dtstart, exdates, MaxOccurrences)
+}
+
+// Remap pairs the occurrences of a rule anchored at oldStart with those of
+// newRule anchored at newStart by their position in the series, so that an
+// exception recorded for the third occurrence still applies to the third
+// occurrence after the series moves to another time or day. The result maps
+// old start times to new ones in unix seconds; occurrences past the end of
+// the new rule are left out. extra raises the occurrence cap for series
+// whose EXDATEs keep them under MaxOccurrences.
+func Remap(oldRule string, oldStart time.Time, newRule string, newStart time.Time, extra int) (map[int64]int64, error) {
+	before, err := expand(oldRule, oldStart, nil, MaxOccurrences+extra)
+	if err != nil {
+		return nil, err
+	}
+	after, err := expand(newRule, newStart, nil, MaxOccurrences+extra)
+	if err != nil {
+		return nil, err
+	}
+
+	remap := make(map[int64]int64, len(before))
+	for i := 0; i < len(before) && i < len(after); i++ {
+		remap[before[i].Unix()] = after[i].Unix()
+	}
+	return remap, nil
+}
+
+func expand(rule string, dtstart time.Time, exdates []time.Time, limit int) ([]time.Time, error) {
+	var lines []string
+	rules := 0
+	for _, line := range strings.FieldsFunc(rule, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.Contains(line, ":") {
+			line = "RRULE:" + line
+		}
+		if strings.HasPrefix(strings.ToUpper(line), "DTSTART") {
+			continue
+		}
+		if strings.HasPrefix(strings.ToUpper(line), "RRULE:") {
+			rules++
+		}
+		lines = append(lines, line)
+	}
+	if rules != 1 {
+		return nil, ErrNoRule
+	}
+
+	set, err := rrule.StrSliceToRRuleSetInLoc(lines, dtstart.Location())
+	if err != nil {
+		return nil, fmt.Errorf("invalid recurrence rule: %w", err)
+	}
+
+	r := set.GetRRule()
+	if r == nil {
+		return nil, ErrNoRule
+	}
+	if r.OrigOptions.Count == 0 && r.OrigOptions.Until.IsZero() {
+		return nil, ErrUnbounded
+	}
+
+	set.DTStart(dtstart)
+	for _, ex := range exdates {
+		set.ExDate(ex.In(dtstart.Location()))
+	}
+
+	var occurrences []time.Time
+	next := set.Iterator()
+	for {
+		t, ok := next()
+		if !ok {
+			break
+		}
+		if len(occurrences) == limit {
+			return nil, ErrTooMany
+		}
+		occurrences = append(occurrences, t)
+	}
+
+	if len(occurrences) == 0 {
+		return nil, ErrNoOccurrences
+	}
+	return occurrences, nil
+}
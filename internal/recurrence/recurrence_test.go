@@ -0,0 +1,182 @@
+package recurrence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func amsterdam(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	return loc
+}
+
+func TestExpand(t *testing.T) {
+	loc := amsterdam(t)
+	// A Tuesday evening.
+	dtstart := time.Date(2026, 3, 3, 19, 0, 0, 0, loc)
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2026, month, d, 19, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		exdates []time.Time
+		want    []time.Time
+	}{
+		{"count", "FREQ=WEEKLY;COUNT=3", nil,
+			[]time.Time{day(3, 3), day(3, 10), day(3, 17)}},
+		{"RRULE prefix", "RRULE:FREQ=WEEKLY;COUNT=2", nil,
+			[]time.Time{day(3, 3), day(3, 10)}},
+		{"until", "FREQ=WEEKLY;UNTIL=20260318T000000Z", nil,
+			[]time.Time{day(3, 3), day(3, 10), day(3, 17)}},
+		{"until on the last occurrence", "FREQ=WEEKLY;UNTIL=20260317T180000Z", nil,
+			[]time.Time{day(3, 3), day(3, 10), day(3, 17)}},
+		{"byday", "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=4", nil,
+			[]time.Time{day(3, 3), day(3, 5), day(3, 10), day(3, 12)}},
+		{"exdate argument", "FREQ=WEEKLY;COUNT=3", []time.Time{day(3, 10)},
+			[]time.Time{day(3, 3), day(3, 17)}},
+		{"exdate in another zone", "FREQ=WEEKLY;COUNT=3", []time.Time{day(3, 10).UTC()},
+			[]time.Time{day(3, 3), day(3, 17)}},
+		{"exdate line", "RRULE:FREQ=WEEKLY;COUNT=3\nEXDATE:20260317T180000Z", nil,
+			[]time.Time{day(3, 3), day(3, 10)}},
+		{"exdate not on an occurrence", "FREQ=WEEKLY;COUNT=2", []time.Time{day(3, 11)},
+			[]time.Time{day(3, 3), day(3, 10)}},
+		{"DTSTART line is ignored", "DTSTART:20200101T000000Z\nRRULE:FREQ=WEEKLY;COUNT=1", nil,
+			[]time.Time{day(3, 3)}},
+		// Amsterdam moves to summer time on 29 March 2026; the slot stays
+		// at 19:00 local time, so it moves an hour in UTC.
+		{"across DST", "FREQ=WEEKLY;COUNT=5", nil,
+			[]time.Time{day(3, 3), day(3, 10), day(3, 17), day(3, 24), day(3, 31)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.rule, dtstart, tt.exdates)
+			if err != nil {
+				t.Fatalf("Expand: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expand = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("occurrence %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExpandKeepsWallClockAcrossDST(t *testing.T) {
+	loc := amsterdam(t)
+	dtstart := time.Date(2026, 10, 20, 19, 0, 0, 0, loc)
+	got, err := Expand("FREQ=WEEKLY;COUNT=2", dtstart, nil)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	for _, occ := range got {
+		if local := occ.In(loc); local.Hour() != 19 || local.Minute() != 0 {
+			t.Errorf("occurrence at %s local time, want 19:00", local.Format("15:04"))
+		}
+	}
+	// Winter time starts on 25 October, so the week is an hour longer.
+	if d := got[1].Sub(got[0]); d != 7*24*time.Hour+time.Hour {
+		t.Errorf("weeks are %s apart, want %s", d, 7*24*time.Hour+time.Hour)
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	dtstart := time.Date(2026, 3, 3, 19, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		rule    string
+		exdates []time.Time
+		want    error
+	}{
+		{"unbounded", "FREQ=WEEKLY", nil, ErrUnbounded},
+		{"too many", "FREQ=DAILY;COUNT=105", nil, ErrTooMany},
+		{"too many until", "FREQ=DAILY;UNTIL=20300101T000000Z", nil, ErrTooMany},
+		{"only exdates", "EXDATE:20260303T190000Z", nil, ErrNoRule},
+		{"empty", "", nil, ErrNoRule},
+		{"two rules", "RRULE:FREQ=WEEKLY;COUNT=2\nRRULE:FREQ=DAILY;COUNT=2", nil, ErrNoRule},
+		{"until before dtstart", "FREQ=WEEKLY;UNTIL=20260101T000000Z", nil, ErrNoOccurrences},
+		{"every occurrence excluded", "FREQ=WEEKLY;COUNT=1", []time.Time{dtstart}, ErrNoOccurrences},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Expand(tt.rule, dtstart, tt.exdates); !errors.Is(err, tt.want) {
+				t.Errorf("Expand error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandLimit(t *testing.T) {
+	dtstart := time.Date(2026, 3, 3, 19, 0, 0, 0, time.UTC)
+	got, err := Expand("FREQ=DAILY;COUNT=104", dtstart, nil)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if len(got) != MaxOccurrences {
+		t.Errorf("got %d occurrences, want %d", len(got), MaxOccurrences)
+	}
+}
+
+func TestExpandInvalid(t *testing.T) {
+	dtstart := time.Date(2026, 3, 3, 19, 0, 0, 0, time.UTC)
+	for _, rule := range []string{"FREQ=SOMETIMES;COUNT=2", "FREQ=WEEKLY;COUNT=x", "FREQ=WEEKLY;BYDAY=XX;COUNT=2"} {
+		if _, err := Expand(rule, dtstart, nil); err == nil {
+			t.Errorf("Expand(%q) succeeded", rule)
+		}
+	}
+}
+
+func TestRemap(t *testing.T) {
+	loc := amsterdam(t)
+	tuesday := time.Date(2026, 10, 13, 19, 0, 0, 0, loc)
+	at := func(month time.Month, d, hour int) int64 {
+		return time.Date(2026, month, d, hour, 0, 0, 0, loc).Unix()
+	}
+
+	// Moving a Tuesday 19:00 series to Wednesday 20:00 keeps the wall-clock
+	// time across the DST change on 25 October and drops the occurrence the
+	// shorter rule no longer has.
+	got, err := Remap("FREQ=WEEKLY;COUNT=3", tuesday, "FREQ=WEEKLY;COUNT=2", time.Date(2026, 10, 14, 20, 0, 0, 0, loc), 0)
+	if err != nil {
+		t.Fatalf("Remap: %v", err)
+	}
+	want := map[int64]int64{
+		at(10, 13, 19): at(10, 14, 20),
+		at(10, 20, 19): at(10, 21, 20),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Remap = %v, want %v", got, want)
+	}
+	for from, to := range want {
+		if got[from] != to {
+			t.Errorf("occurrence at %s maps to %s, want %s", time.Unix(from, 0).In(loc), time.Unix(got[from], 0).In(loc), time.Unix(to, 0).In(loc))
+		}
+	}
+}
+
+func TestRemapExtra(t *testing.T) {
+	dtstart := time.Date(2026, 3, 3, 19, 0, 0, 0, time.UTC)
+	// A series of 106 with two EXDATEs stays within the limit, so its
+	// occurrences can be remapped with room for those two.
+	if _, err := Remap("FREQ=DAILY;COUNT=106", dtstart, "FREQ=DAILY;COUNT=106", dtstart.Add(time.Hour), 0); !errors.Is(err, ErrTooMany) {
+		t.Errorf("Remap without extra error = %v, want %v", err, ErrTooMany)
+	}
+	got, err := Remap("FREQ=DAILY;COUNT=106", dtstart, "FREQ=DAILY;COUNT=106", dtstart.Add(time.Hour), 2)
+	if err != nil {
+		t.Fatalf("Remap: %v", err)
+	}
+	if len(got) != 106 {
+		t.Errorf("got %d occurrences, want 106", len(got))
+	}
+}
@@ -1,11 +1,15 @@
 package routes
 
 import (
+	"door-control/internal/actuator"
+	"door-control/internal/attestation"
 	"door-control/internal/db"
 	"door-control/internal/handlers"
 	"door-control/internal/middleware"
+	"door-control/internal/models"
 	"html/template"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/go-webauthn/webauthn/webauthn"
@@ -13,14 +17,25 @@ import (
 	"golang.org/x/time/rate"
 )
 
-func Setup(database *db.DB, webAuthn *webauthn.WebAuthn, store *sessions.CookieStore, tmpl *template.Template) {
+// Keys are derived from SESSION_SECRET, one per purpose.
+type Keys struct {
+	// Guest signs guest links.
+	Guest []byte
+	// Presence derives the door codes.
+	Presence []byte
+}
+
+func Setup(database *db.DB, webAuthn *webauthn.WebAuthn, store sessions.Store, tmpl *template.Template, actuators *actuator.Registry, keys Keys, policy *attestation.Policy) {
 	limiter := middleware.NewIPRateLimiter(rate.Every(1*time.Second), 5)
+	// Recovery codes can be guessed, so attempts are limited much harder.
+	recoveryLimiter := middleware.NewIPRateLimiter(rate.Every(1*time.Minute), 5)
 
 	registerHandler := &handlers.RegisterHandler{
-		DB:        database,
-		WebAuthn:  webAuthn,
-		Store:     store,
-		Templates: tmpl,
+		DB:          database,
+		WebAuthn:    webAuthn,
+		Store:       store,
+		Templates:   tmpl,
+		Attestation: policy,
 	}
 
 	loginHandler := &handlers.LoginHandler{
@@ -37,11 +52,59 @@ func Setup(database *db.DB, webAuthn *webauthn.WebAuthn, store *sessions.CookieS
 	}
 
 	bookingHandler := &handlers.BookingHandler{
+		DB:             database,
+		WebAuthn:       webAuthn,
+		Store:          store,
+		Templates:      tmpl,
+		Actuators:      actuators,
+		GuestSecret:    keys.Guest,
+		PresenceSecret: keys.Presence,
+	}
+
+	credentialsHandler := &handlers.CredentialsHandler{
+		DB:          database,
+		WebAuthn:    webAuthn,
+		Store:       store,
+		Templates:   tmpl,
+		Attestation: policy,
+	}
+
+	profileHandler := &handlers.ProfileHandler{
 		DB:        database,
 		Store:     store,
 		Templates: tmpl,
 	}
 
+	recoveryHandler := &handlers.RecoveryHandler{
+		DB:          database,
+		WebAuthn:    webAuthn,
+		Store:       store,
+		Templates:   tmpl,
+		Attestation: policy,
+	}
+
+	sessionsHandler := &handlers.SessionsHandler{
+		DB:    database,
+		Store: store,
+	}
+
+	calendarHandler := &handlers.CalendarHandler{
+		DB:         database,
+		Store:      store,
+		Domain:     webAuthn.Config.RPID,
+		AdminToken: os.Getenv("ADMIN_CALENDAR_TOKEN"),
+	}
+
+	adminHandler := &handlers.AdminHandler{
+		DB:        database,
+		Templates: tmpl,
+	}
+
+	authz := &middleware.Authorizer{
+		DB:    database,
+		Store: store,
+	}
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 	})
@@ -53,14 +116,83 @@ func Setup(database *db.DB, webAuthn *webauthn.WebAuthn, store *sessions.CookieS
 	http.HandleFunc("/login", loginHandler.LoginPage)
 	http.HandleFunc("/login/begin", limiter.Limit(loginHandler.BeginLogin))
 	http.HandleFunc("/login/finish", limiter.Limit(loginHandler.FinishLogin))
+	http.HandleFunc("POST /login/passkey/begin", limiter.Limit(loginHandler.BeginDiscoverableLogin))
+	http.HandleFunc("POST /login/passkey/finish", limiter.Limit(loginHandler.FinishDiscoverableLogin))
 	http.HandleFunc("/logout", loginHandler.Logout)
+	http.HandleFunc("GET /recover", recoveryHandler.RecoverPage)
+	http.HandleFunc("POST /recover/begin", recoveryLimiter.Limit(recoveryHandler.BeginRecovery))
+	http.HandleFunc("POST /recover/finish", limiter.Limit(recoveryHandler.FinishRecovery))
+	http.HandleFunc("POST /recovery-codes/begin", limiter.Limit(recoveryHandler.BeginRegenerateCodes))
+	http.HandleFunc("POST /recovery-codes", limiter.Limit(recoveryHandler.RegenerateCodes))
 
 	http.HandleFunc("/dashboard", dashboardHandler.Dashboard)
+	http.HandleFunc("GET /sessions", sessionsHandler.ListSessions)
+	http.HandleFunc("POST /sessions/{id}/revoke", sessionsHandler.RevokeSession)
+	http.HandleFunc("POST /sessions/revoke-others", sessionsHandler.RevokeOtherSessions)
+
+	http.HandleFunc("GET /profile", profileHandler.ProfilePage)
+	http.HandleFunc("POST /profile", profileHandler.UpdateProfile)
+
+	http.HandleFunc("GET /passkeys", credentialsHandler.CredentialsPage)
+	http.HandleFunc("POST /passkeys/begin", credentialsHandler.BeginAddCredential)
+	http.HandleFunc("POST /passkeys/finish", credentialsHandler.FinishAddCredential)
+	http.HandleFunc("PATCH /passkeys/{id}", credentialsHandler.RenameCredential)
+	http.HandleFunc("DELETE /passkeys/{id}", credentialsHandler.DeleteCredential)
 
 	http.HandleFunc("/booking", bookingHandler.BookingPage)
-	http.HandleFunc("/booking/create", bookingHandler.CreateBooking)
+	http.HandleFunc("POST /booking/create", bookingHandler.CreateBooking)
+	http.HandleFunc("PATCH /booking/{id}", bookingHandler.UpdateBooking)
+	http.HandleFunc("POST /booking/{id}/cancel", bookingHandler.CancelBooking)
+	http.HandleFunc("GET /booking/{id}/history", bookingHandler.BookingHistory)
+	http.HandleFunc("PATCH /booking/series/{id}", bookingHandler.UpdateSeries)
+	http.HandleFunc("POST /booking/series/{id}/cancel", bookingHandler.CancelSeries)
+	http.HandleFunc("GET /booking/{id}/guests", bookingHandler.ListGuestPasses)
+	http.HandleFunc("POST /booking/{id}/guests", bookingHandler.CreateGuestPass)
+	http.HandleFunc("POST /booking/{id}/guests/{guest}/revoke", bookingHandler.RevokeGuestPass)
 	http.HandleFunc("/bookings", bookingHandler.GetUserBookings)
+	http.HandleFunc("GET /calendar/{file}", calendarHandler.Feed)
+	http.HandleFunc("POST /calendar/reset", calendarHandler.ResetToken)
 	http.HandleFunc("/unlock", bookingHandler.UnlockDoor)
+	http.HandleFunc("POST /unlock/begin", bookingHandler.BeginUnlockStepUp)
+	http.HandleFunc("GET /unlock/challenge", bookingHandler.UnlockChallenge)
+	http.HandleFunc("GET /guest/{token}", bookingHandler.GuestPage)
+	http.HandleFunc("POST /guest/{token}/unlock", limiter.Limit(bookingHandler.GuestUnlock))
+	http.HandleFunc("/door/status", bookingHandler.DoorStatus)
+	http.HandleFunc("GET /door/{id}/display", bookingHandler.DoorDisplay)
+	http.HandleFunc("GET /door/{id}/display/code", bookingHandler.DoorDisplayCode)
+	http.HandleFunc("GET /door/{id}/scan", bookingHandler.DoorScan)
+
+	http.HandleFunc("GET /admin", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+	})
+	http.HandleFunc("GET /admin/users", authz.Require(models.PermViewUsers, adminHandler.UsersPage))
+	http.HandleFunc("GET /admin/users/{id}", authz.Require(models.PermViewUsers, adminHandler.UserPage))
+	http.HandleFunc("GET /admin/bookings", authz.Require(models.PermViewAllBookings, adminHandler.BookingsPage))
+	http.HandleFunc("GET /admin/approvals", authz.Require(models.PermViewUsers, adminHandler.ApprovalsPage))
+	http.HandleFunc("GET /admin/invites", authz.Require(models.PermViewUsers, adminHandler.InvitesPage))
+	http.HandleFunc("GET /admin/doors", authz.Require(models.PermViewDoors, adminHandler.DoorsPage))
+	http.HandleFunc("GET /admin/incidents", authz.Require(models.PermViewAudit, adminHandler.IncidentsPage))
+	http.HandleFunc("GET /admin/audit", authz.Require(models.PermViewAudit, adminHandler.AuditPage))
+	http.HandleFunc("GET /admin/audit/export", authz.Require(models.PermViewAudit, adminHandler.ExportAudit))
+
+	http.HandleFunc("GET /admin/api/users", authz.Require(models.PermViewUsers, adminHandler.ListUsers))
+	http.HandleFunc("PUT /admin/api/users/{id}/role", authz.Require(models.PermManageRoles, adminHandler.SetUserRole))
+	http.HandleFunc("PUT /admin/api/users/{id}/status", authz.Require(models.PermManageUsers, adminHandler.SetUserStatus))
+	http.HandleFunc("POST /admin/api/users/{id}/approve", authz.Require(models.PermManageUsers, adminHandler.ApproveUser))
+	http.HandleFunc("POST /admin/api/users/{id}/reject", authz.Require(models.PermManageUsers, adminHandler.RejectUser))
+	http.HandleFunc("GET /admin/api/users/{id}/credentials", authz.Require(models.PermViewUsers, adminHandler.UserCredentials))
+	http.HandleFunc("DELETE /admin/api/credentials/{id}", authz.Require(models.PermManageUsers, adminHandler.RevokeCredential))
+	http.HandleFunc("GET /admin/api/users/{id}/sessions", authz.Require(models.PermViewUsers, adminHandler.UserSessions))
+	http.HandleFunc("POST /admin/api/users/{id}/sessions/revoke", authz.Require(models.PermManageUsers, adminHandler.RevokeUserSessions))
+	http.HandleFunc("DELETE /admin/api/sessions/{id}", authz.Require(models.PermManageUsers, adminHandler.RevokeSession))
+	http.HandleFunc("GET /admin/api/invites", authz.Require(models.PermViewUsers, adminHandler.ListInvites))
+	http.HandleFunc("POST /admin/api/invites", authz.Require(models.PermManageUsers, adminHandler.CreateInvite))
+	http.HandleFunc("DELETE /admin/api/invites/{id}", authz.Require(models.PermManageUsers, adminHandler.RevokeInvite))
+	http.HandleFunc("POST /admin/api/incidents/{id}/resolve", authz.Require(models.PermManageUsers, adminHandler.ResolveIncident))
+	http.HandleFunc("GET /admin/api/audit", authz.Require(models.PermViewAudit, adminHandler.AuditEvents))
+	http.HandleFunc("POST /admin/api/doors/{id}/display-link", authz.Require(models.PermManageDoors, adminHandler.ResetDisplayLink))
+	http.HandleFunc("GET /admin/api/bookings", authz.Require(models.PermViewAllBookings, adminHandler.ListBookings))
+	http.HandleFunc("POST /admin/api/bookings/{id}/cancel", authz.Require(models.PermManageBookings, adminHandler.CancelBooking))
 
 	fs := http.FileServer(http.Dir("static"))
 	http.Handle("/static/", http.StripPrefix("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
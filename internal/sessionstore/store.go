@@ -0,0 +1,163 @@
+package sessionstore
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"door-control/internal/db"
+	"door-control/internal/middleware"
+	"encoding/base32"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// touchInterval limits how often reading a session updates last_seen_at.
+const touchInterval = 5 * time.Minute
+
+// Store keeps session values in SQLite and only a signed session token in
+// the cookie, so sessions can be listed and revoked on the server.
+type Store struct {
+	DB      *db.DB
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+}
+
+func New(database *db.DB, keyPairs ...[]byte) *Store {
+	s := &Store{
+		DB:     database,
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: 86400,
+		},
+	}
+	s.MaxAge(s.Options.MaxAge)
+
+	go s.cleanupExpired()
+	return s
+}
+
+// TokenHash is how a session token is stored in the database.
+func TokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session named by the request cookie. A cookie whose session
+// was revoked or expired yields a fresh, empty session.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var token string
+	if err := securecookie.DecodeMulti(name, c.Value, &token, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	hash := TokenHash(token)
+	now := time.Now()
+	data, lastSeen, err := s.DB.LoadSession(hash, now.Unix())
+	if err == sql.ErrNoRows {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if err := securecookie.DecodeMulti(name, data, &session.Values, s.Codecs...); err != nil {
+		return session, err
+	}
+	session.ID = token
+	session.IsNew = false
+
+	if now.Unix()-lastSeen > int64(touchInterval.Seconds()) {
+		if err := s.DB.TouchSession(hash, middleware.ClientIP(r), now.Unix()); err != nil {
+			log.Printf("Error updating session: %v", err)
+		}
+	}
+	return session, nil
+}
+
+// Save writes the session to the database and sets the cookie. A session
+// with MaxAge <= 0 is deleted.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			if err := s.DB.DeleteSession(TokenHash(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(securecookie.GenerateRandomKey(32))
+	}
+
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	row := db.Session{
+		TokenHash:  TokenHash(session.ID),
+		UserAgent:  r.UserAgent(),
+		IP:         middleware.ClientIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now + int64(session.Options.MaxAge),
+	}
+	if session.Values["authenticated"] == true {
+		row.UserID, _ = session.Values["userID"].(int64)
+		row.CredentialID, _ = session.Values["credentialID"].(string)
+	}
+	if err := s.DB.SaveSession(row, data); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// MaxAge sets how long new sessions and their cookies stay valid.
+func (s *Store) MaxAge(age int) {
+	s.Options.MaxAge = age
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+func (s *Store) cleanupExpired() {
+	for {
+		time.Sleep(10 * time.Minute)
+		n, err := s.DB.DeleteExpiredSessions(time.Now().Unix())
+		if err != nil {
+			log.Printf("Error deleting expired sessions: %v", err)
+		} else if n > 0 {
+			log.Printf("Deleted %d expired sessions", n)
+		}
+	}
+}
@@ -1,14 +1,27 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"door-control/internal/actuator"
+	"door-control/internal/attestation"
 	"door-control/internal/db"
+	"door-control/internal/geofence"
+	"door-control/internal/handlers"
+	"door-control/internal/presence"
 	"door-control/internal/routes"
+	"door-control/internal/sessionstore"
+	"encoding/json"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gorilla/sessions"
 	"github.com/joho/godotenv"
@@ -23,6 +36,61 @@ func getEnvFloat(key string, defaultVal float64) float64 {
 	return defaultVal
 }
 
+func getEnv(key, defaultVal string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return defaultVal
+}
+
+func loadDoorsFile(database *db.DB, path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doors []db.Door
+	if err := json.Unmarshal(raw, &doors); err != nil {
+		return err
+	}
+
+	for _, door := range doors {
+		if door.Site == "" {
+			door.Site = "main"
+		}
+		if door.RadiusM <= 0 {
+			door.RadiusM = 50
+		}
+		if !presence.ValidMode(door.Presence) {
+			return fmt.Errorf("door %q: unknown presence mode %q", door.Name, door.Presence)
+		}
+		if len(door.Geofence) > 0 {
+			if _, err := geofence.ParseGeoJSON(door.Geofence); err != nil {
+				return fmt.Errorf("door %q: invalid geofence: %w", door.Name, err)
+			}
+		}
+		if _, err := database.UpsertDoor(door, time.Now().Unix()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deriveKey derives the key for one purpose from SESSION_SECRET, which
+// itself only signs session cookies.
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func actuatorName(cfg actuator.Config) string {
+	if cfg.Driver == "" {
+		return "simulated"
+	}
+	return cfg.Driver
+}
+
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
@@ -38,31 +106,79 @@ func main() {
 		RPDisplayName: "Door Control",
 		RPID:          "doorctrl.sooth.dev",
 		RPOrigins:     []string{"https://doorctrl.sooth.dev", "http://localhost:8080"},
+		// Discoverable credentials allow logging in without a username.
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+	}
+
+	policy, err := attestation.PolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to set up attestation policy: %v", err)
 	}
+	policy.Apply(wconfig)
 
 	webAuthn, err := webauthn.New(wconfig)
 	if err != nil {
 		log.Fatalf("Failed to create WebAuthn: %v", err)
 	}
 
-	sessionSecret := []byte("super-secret-key-change-in-production")
-	if envSecret := []byte(os.Getenv("SESSION_SECRET")); len(envSecret) > 0 {
-		sessionSecret = envSecret
-	} else {
-		log.Println("WARNING: Using default SESSION_SECRET. Set SESSION_SECRET environment variable in production!")
+	// Guest links and door codes use keys derived from the
+	// secret, so a guessable secret would let anyone forge them.
+	sessionSecret := []byte(os.Getenv("SESSION_SECRET"))
+	if len(sessionSecret) == 0 || string(sessionSecret) == "super-secret-key-change-in-production" {
+		log.Fatal("SESSION_SECRET is not set. Set it to a long random value, e.g. the output of `openssl rand -hex 32`.")
 	}
-	store := sessions.NewCookieStore(sessionSecret)
+	store := sessionstore.New(database, sessionSecret)
 	store.Options = &sessions.Options{
 		Path:     "/",
-		MaxAge:   3600 * 24,
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteLaxMode,
 	}
+	store.MaxAge(3600 * 24)
+
+	if doorsFile := os.Getenv("DOORS_FILE"); doorsFile != "" {
+		if err := loadDoorsFile(database, doorsFile); err != nil {
+			log.Fatalf("Failed to load doors from %s: %v", doorsFile, err)
+		}
+	}
+
+	defaultDoor := db.Door{
+		Name:         getEnv("STUDIO_DOOR_NAME", "Studio"),
+		Site:         "main",
+		Latitude:     getEnvFloat("STUDIO_LATITUDE", 0),
+		Longitude:    getEnvFloat("STUDIO_LONGITUDE", 0),
+		RadiusM:      getEnvFloat("STUDIO_RADIUS_M", 50),
+		MaxAccuracyM: getEnvFloat("STUDIO_MAX_ACCURACY_M", 0),
+	}
+	if err := database.EnsureDefaultDoor(defaultDoor, time.Now().Unix()); err != nil {
+		log.Fatalf("Failed to set up default door: %v", err)
+	}
+
+	if err := handlers.PromoteBootstrapAdmins(database); err != nil {
+		log.Fatalf("Failed to promote admins: %v", err)
+	}
+
+	actuatorConfig := actuator.ConfigFromEnv()
+	actuators, err := actuator.NewRegistry(actuatorConfig)
+	if err != nil {
+		log.Fatalf("Failed to create door actuator: %v", err)
+	}
+	doors, err := database.ListDoors()
+	if err != nil {
+		log.Fatalf("Failed to load doors: %v", err)
+	}
+	actuators.SetDoorCount(len(doors))
 
 	tmpl := template.Must(template.ParseGlob("templates/*.html"))
 
-	routes.Setup(database, webAuthn, store, tmpl)
+	keys := routes.Keys{
+		Guest:    deriveKey(sessionSecret, "guest-links"),
+		Presence: deriveKey(sessionSecret, "door-codes"),
+	}
+	routes.Setup(database, webAuthn, store, tmpl, actuators, keys, policy)
 
 	log.Println("========================================")
 	log.Println("Door Control System Starting")
@@ -72,9 +188,20 @@ func main() {
 	log.Println("Local access: http://localhost:8080")
 	log.Printf("WebAuthn RPID: %s", wconfig.RPID)
 	log.Printf("Rate limiting: 5 requests per second per IP")
-	log.Printf("Studio location: %.6f, %.6f",
-		getEnvFloat("STUDIO_LATITUDE", 0),
-		getEnvFloat("STUDIO_LONGITUDE", 0))
+	log.Printf("Registration mode: %s", handlers.RegistrationMode())
+	log.Printf("Authenticator policy: %s", policy)
+	log.Printf("Default door actuator: %s (unlock for %s)", actuatorName(actuatorConfig), actuatorConfig.UnlockDuration())
+	for _, door := range doors {
+		fence := fmt.Sprintf("radius %.0f m", door.RadiusM)
+		if len(door.Geofence) > 0 {
+			fence = "polygon geofence"
+		}
+		log.Printf("Door %d: %s (%s) at %.6f, %.6f, %s, presence %s",
+			door.ID, door.Name, door.Site, door.Latitude, door.Longitude, fence, door.Presence)
+		if len(door.ActuatorConfig) == 0 && len(doors) > 1 {
+			log.Printf("WARNING: door %s has no actuator config and cannot be unlocked; set \"actuator\": {\"driver\": \"default\"} to use the default actuator", door.Name)
+		}
+	}
 	log.Println("========================================")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
@@ -44,8 +44,11 @@ async function registerWithWebAuthn(options) {
     };
 }
 
-async function loginWithWebAuthn(options) {
+async function loginWithWebAuthn(options, signal) {
     options.publicKey.challenge = base64urlToBuffer(options.publicKey.challenge);
+    if (signal) {
+        options.signal = signal;
+    }
     
     if (options.publicKey.allowCredentials) {
         options.publicKey.allowCredentials = options.publicKey.allowCredentials.map(cred => ({